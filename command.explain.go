@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/webdevops/kube-pool-manager/config"
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+type (
+	ExplainCommand struct {
+		Output string `long:"output" short:"o" description:"Output format" choice:"text" choice:"json" default:"text"`
+		Args   struct {
+			Files []string `positional-arg-name:"NODE-FILE" description:"Node manifests (YAML or JSON, eg. output of kubectl get node -o yaml)" required:"1"`
+		} `positional-args:"yes" required:"yes"`
+	}
+)
+
+var (
+	explainCommand ExplainCommand
+)
+
+// runExplain evaluates the pool configuration against node manifests without cluster access
+func runExplain(w io.Writer) error {
+	conf, err := config.ParseFile(Opts.Config)
+	if err != nil {
+		return fmt.Errorf(`unable to parse config "%v": %w`, Opts.Config, err)
+	}
+
+	// same patch as sent by the manager (including the removal of the startup taint)
+	startupTaint := ""
+	if Opts.StartupTaint.Enabled {
+		conf = conf.WithStartupTaint()
+		startupTaint = Opts.StartupTaint.Taint
+	}
+
+	explanations := []*config.NodeExplanation{}
+	for _, path := range explainCommand.Args.Files {
+		/* #nosec */
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		nodeList, err := k8s.ParseNodeManifests(data)
+		if err != nil {
+			return fmt.Errorf(`unable to parse nodes from "%v": %w`, path, err)
+		}
+
+		for _, node := range nodeList {
+			explanations = append(explanations, conf.Explain(node, startupTaint))
+		}
+	}
+
+	switch explainCommand.Output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(explanations)
+	default:
+		for _, explanation := range explanations {
+			if err := writeExplanation(w, explanation); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeExplanation(w io.Writer, explanation *config.NodeExplanation) error {
+	lines := []string{
+		fmt.Sprintf("node \"%s\":", explanation.Node),
+	}
+
+	for _, pool := range explanation.Pools {
+		status := "not matching"
+		switch {
+		case pool.Error != "":
+			status = fmt.Sprintf("error: %s", pool.Error)
+		case !pool.Evaluated:
+			status = "not evaluated (stopped by previous pool)"
+		case pool.Matching && !pool.Ready:
+			status = fmt.Sprintf("matching, not applied yet (readiness gate: %s)", pool.ReadinessGate)
+		case pool.Matching:
+			status = "matching"
+		}
+		lines = append(lines, fmt.Sprintf("  pool \"%s\": %s", pool.Name, status))
+
+		for _, selector := range pool.Selectors {
+			lines = appendSelectorExplanation(lines, selector, "    ")
+		}
+	}
+
+	if explanation.Error != "" {
+		lines = append(lines, fmt.Sprintf("  error: %s", explanation.Error))
+	}
+
+	lines = append(lines, fmt.Sprintf("  matching pools: %s", strings.Join(explanation.MatchingPools, ", ")))
+
+	patch, err := json.MarshalIndent(explanation.Patch, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	lines = append(lines, fmt.Sprintf("  json patch:\n    %s", patch), "")
+
+	_, err = fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// appendSelectorExplanation appends the selector result and all nested selector group results
+func appendSelectorExplanation(lines []string, selector *config.SelectorResult, indent string) []string {
+	if selector.Path != "" {
+		value := "<not found>"
+		if selector.Value != nil {
+			value = fmt.Sprintf("%q", *selector.Value)
+		}
+		lines = append(lines, fmt.Sprintf("%sselector \"%s\" = %s: matching=%v (%s)", indent, selector.Path, value, selector.Matching, selector.Message))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s%s: matching=%v (%s)", indent, selector.Description(), selector.Matching, selector.Message))
+	}
+
+	for _, child := range selector.Children {
+		lines = appendSelectorExplanation(lines, child, indent+"  ")
+	}
+
+	return lines
+}
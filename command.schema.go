@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+type (
+	SchemaCommand struct{}
+)
+
+var (
+	schemaCommand SchemaCommand
+)
+
+// runSchema prints the json schema of the configuration file
+func runSchema(w io.Writer) error {
+	schema, err := config.JsonSchema()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(schema))
+	return err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+type (
+	ValidateCommand struct {
+		Args struct {
+			Files []string `positional-arg-name:"CONFIG-FILE" description:"Config files to validate (default: --config)"`
+		} `positional-args:"yes"`
+	}
+)
+
+var (
+	validateCommand ValidateCommand
+)
+
+// runValidate validates config files strictly and prints all errors with file and line
+func runValidate(w io.Writer) error {
+	files := validateCommand.Args.Files
+	if len(files) == 0 {
+		files = []string{Opts.Config}
+	}
+
+	failed := false
+	for _, path := range files {
+		err := config.ValidateFile(path)
+		if err == nil {
+			if _, err := fmt.Fprintf(w, "%s: ok\n", path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		failed = true
+
+		var validationErrors config.ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			validationErrors = config.ValidationErrors{{File: path, Message: err.Error()}}
+		}
+
+		for _, validationError := range validationErrors {
+			if _, err := fmt.Fprintln(w, validationError.Error()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("config validation failed")
+	}
+
+	return nil
+}
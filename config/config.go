@@ -1,35 +1,73 @@
 package config
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"os"
 	"regexp"
-	"strings"
 
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/util/jsonpath"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/webdevops/kube-pool-manager/k8s"
 )
 
+const (
+	// PoolModeAll applies all matching pools to a node
+	PoolModeAll = "all"
+
+	// PoolModeFirstMatch evaluates pools in order and stops at the first matching pool without continue
+	PoolModeFirstMatch = "firstMatch"
+)
+
 type (
 	Config struct {
-		Pools []PoolConfig `yaml:"pools"`
+		PoolMode      string         `yaml:"poolMode" enum:"all,firstMatch"`
+		ReadinessGate *ReadinessGate `yaml:"readinessGate"`
+		Pools         []PoolConfig   `yaml:"pools"`
+
+		hash string
 	}
 
 	PoolConfig struct {
-		Name     string               `yaml:"pool"`
-		Continue bool                 `yaml:"continue"`
-		Selector []PoolConfigSelector `yaml:"selector"`
-		Node     PoolConfigNode       `yaml:"node"`
+		Name          string               `yaml:"pool"`
+		Continue      bool                 `yaml:"continue"`
+		LabelSelector string               `yaml:"labelSelector"`
+		FieldSelector string               `yaml:"fieldSelector"`
+		Selector      []PoolConfigSelector `yaml:"selector"`
+		ReadinessGate *ReadinessGate       `yaml:"readinessGate"`
+		Node          PoolConfigNode       `yaml:"node"`
+
+		labelSelector labels.Selector
+		fieldSelector fields.Selector
 	}
 
 	PoolConfigSelector struct {
-		Path     string `yaml:"path"`
-		jsonPath *jsonpath.JSONPath
-		Match    *string `yaml:"match"`
-		Regexp   *string `yaml:"regexp"`
+		Path      string   `yaml:"path"`
+		Match     *string  `yaml:"match"`
+		Regexp    *string  `yaml:"regexp"`
+		Exists    bool     `yaml:"exists"`
+		NotExists bool     `yaml:"notExists"`
+		In        []string `yaml:"in"`
+		NotIn     []string `yaml:"notIn"`
+		Type      string   `yaml:"type" enum:"int,quantity,semver"`
+		Gt        *string  `yaml:"gt"`
+		Gte       *string  `yaml:"gte"`
+		Lt        *string  `yaml:"lt"`
+		Lte       *string  `yaml:"lte"`
+		Not       bool     `yaml:"not"`
+
+		ProviderID *PoolConfigSelectorProviderID `yaml:"providerID"`
+
+		AllOf  []PoolConfigSelector `yaml:"allOf"`
+		AnyOf  []PoolConfigSelector `yaml:"anyOf"`
+		NoneOf []PoolConfigSelector `yaml:"noneOf"`
+
 		regexp   *regexp.Regexp
+		jsonPath *compiledJsonPath
 	}
 
 	PoolConfigNode struct {
@@ -38,6 +76,7 @@ type (
 		ConfigSource *PoolConfigNodeConfigSource `yaml:"configSource"`
 		Labels       PoolConfigNodeValueMap      `yaml:"labels"`
 		Annotations  PoolConfigNodeValueMap      `yaml:"annotations"`
+		Taints       PoolConfigNodeTaintMap      `yaml:"taints"`
 	}
 
 	PoolConfigNodeConfigSource struct {
@@ -53,6 +92,193 @@ type (
 	}
 )
 
+// ParseFile reads, parses and compiles the configuration file
+func ParseFile(path string) (*Config, error) {
+	/* #nosec */
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses, validates and compiles the configuration (strict errors are only reported by Validate)
+func Parse(data []byte) (*Config, error) {
+	conf := &Config{}
+	if err := yaml.Unmarshal(data, conf); err != nil {
+		return nil, err
+	}
+
+	if validationErrors := conf.Validate().Required(); len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	if err := conf.Compile(); err != nil {
+		return nil, err
+	}
+
+	conf.hash = Checksum(data)
+
+	return conf, nil
+}
+
+// Checksum returns the sha256 checksum of the raw configuration
+func Checksum(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// Hash returns the sha256 checksum of the parsed configuration file
+func (c *Config) Hash() string {
+	return c.hash
+}
+
+func (c *Config) GetPoolMode() string {
+	if c.PoolMode == "" {
+		return PoolModeAll
+	}
+	return c.PoolMode
+}
+
+// MatchingPools returns all pools (in configuration order) which should be applied to the node,
+// broken pools are skipped and returned as PoolErrors (with poolMode firstMatch the evaluation stops at a broken pool)
+func (c *Config) MatchingPools(logger *zap.SugaredLogger, node *corev1.Node) ([]*PoolConfig, error) {
+	return c.matchingPools(logger, func(poolConfig *PoolConfig, poolLogger *zap.SugaredLogger) (bool, error) {
+		return poolConfig.IsMatchingNode(poolLogger, node)
+	})
+}
+
+// matchingPools evaluates the pools in the order of the poolMode, isMatching decides if a single pool is matching
+func (c *Config) matchingPools(logger *zap.SugaredLogger, isMatching func(poolConfig *PoolConfig, poolLogger *zap.SugaredLogger) (bool, error)) ([]*PoolConfig, error) {
+	poolMode := c.GetPoolMode()
+	switch poolMode {
+	case PoolModeAll, PoolModeFirstMatch:
+	default:
+		return nil, fmt.Errorf(`invalid poolMode "%v", expected "%v" or "%v"`, poolMode, PoolModeAll, PoolModeFirstMatch)
+	}
+
+	pools := []*PoolConfig{}
+	poolErrors := PoolErrors{}
+	for num := range c.Pools {
+		poolConfig := &c.Pools[num]
+		poolLogger := logger.With(zap.String("pool", poolConfig.Name))
+
+		matching, err := isMatching(poolConfig, poolLogger)
+		if err != nil {
+			poolLogger.Errorf("pool \"%s\" is broken, skipping pool: %v", poolConfig.Name, err)
+			poolErrors = append(poolErrors, &PoolError{Pool: poolConfig.Name, Err: err})
+
+			// it's unknown if the broken pool would be matching, so later pools can't be evaluated
+			if poolMode == PoolModeFirstMatch {
+				break
+			}
+			continue
+		}
+
+		if !matching {
+			poolLogger.Debugf("Node NOT matches pool \"%s\"", poolConfig.Name)
+			continue
+		}
+
+		pools = append(pools, poolConfig)
+
+		if poolMode == PoolModeFirstMatch && !poolConfig.Continue {
+			poolLogger.Debugf("pool \"%s\" is matching and has no continue flag, stopping pool evaluation", poolConfig.Name)
+			break
+		}
+	}
+
+	return pools, poolErrors.errOrNil()
+}
+
+// CreateJsonPatchSet creates the merged json patch set of all matching pools, later pools override earlier ones,
+// broken pools are skipped (keeping their managed keys) and returned as PoolErrors together with the patch set.
+// Matching pools waiting for their readiness gate are not applied and returned as gatedPoolNameList
+func (c *Config) CreateJsonPatchSet(logger *zap.SugaredLogger, node *corev1.Node) (patchSet *k8s.JsonPatchSet, poolNameList, gatedPoolNameList []string, err error) {
+	pools, err := c.MatchingPools(logger, node)
+	if _, ok := AsPoolErrors(err); err != nil && !ok {
+		return nil, nil, nil, err
+	}
+
+	return c.createJsonPatchSet(logger, node, pools, err)
+}
+
+// createJsonPatchSet creates the merged json patch set of the matching pools, matchErr contains the PoolErrors of the pool evaluation
+func (c *Config) createJsonPatchSet(logger *zap.SugaredLogger, node *corev1.Node, matchingPools []*PoolConfig, matchErr error) (patchSet *k8s.JsonPatchSet, poolNameList, gatedPoolNameList []string, err error) {
+	patchSet = k8s.NewJsonPatchSet()
+	poolNameList = []string{}
+	gatedPoolNameList = []string{}
+
+	poolErrors, _ := AsPoolErrors(matchErr)
+
+	// pools waiting for their readiness gate are not applied yet
+	pools, gatedPools := c.splitPoolsByReadiness(logger, node, matchingPools)
+	for _, poolConfig := range gatedPools {
+		gatedPoolNameList = append(gatedPoolNameList, poolConfig.Name)
+	}
+	unevaluatedPools := c.unevaluatedPools(poolErrors)
+
+	// taints are patched as whole list, so each pool needs to be based on the taints of the previous pools
+	workingNode := node.DeepCopy()
+
+	appliedPools := []*PoolConfig{}
+	for _, poolConfig := range pools {
+		poolLogger := logger.With(zap.String("pool", poolConfig.Name))
+
+		// templates are rendered against the original node
+		renderedPool, err := poolConfig.Render(node)
+		if err != nil {
+			poolLogger.Errorf("pool \"%s\" is broken, skipping pool: %v", poolConfig.Name, err)
+			poolErrors = append(poolErrors, &PoolError{Pool: poolConfig.Name, Err: err})
+			continue
+		}
+
+		poolLogger.Infof("adding configuration from pool \"%s\" to node \"%s\"", poolConfig.Name, node.Name)
+		patchSet.AddSet(renderedPool.createJsonPatchSet(workingNode))
+		workingNode.Spec.Taints, _ = renderedPool.Node.Taints.Apply(workingNode.Spec.Taints)
+		appliedPools = append(appliedPools, poolConfig)
+		poolNameList = append(poolNameList, poolConfig.Name)
+	}
+
+	// garbage collect keys which are no longer set by any pool (keys of gated and broken pools are kept)
+	retainedPools := append([]*PoolConfig{}, gatedPools...)
+	for _, poolName := range poolErrors.Pools() {
+		if poolConfig := c.poolByName(poolName); poolConfig != nil {
+			retainedPools = append(retainedPools, poolConfig)
+		}
+	}
+	retainedPools = append(retainedPools, unevaluatedPools...)
+	addManagedKeysPatches(logger, workingNode, patchSet, appliedPools, retainedPools)
+	addTaintsPrecondition(patchSet, node)
+
+	return patchSet, poolNameList, gatedPoolNameList, poolErrors.errOrNil()
+}
+
+// unevaluatedPools returns the pools after a broken pool which were not evaluated because of poolMode firstMatch
+// (it's unknown if they would be matching, so their managed keys have to be kept)
+func (c *Config) unevaluatedPools(poolErrors PoolErrors) []*PoolConfig {
+	ret := []*PoolConfig{}
+	if c.GetPoolMode() != PoolModeFirstMatch || len(poolErrors) == 0 {
+		return ret
+	}
+
+	brokenPool := poolErrors[len(poolErrors)-1].Pool
+	for num := len(c.Pools) - 1; num >= 0 && c.Pools[num].Name != brokenPool; num-- {
+		ret = append([]*PoolConfig{&c.Pools[num]}, ret...)
+	}
+	return ret
+}
+
+// poolByName returns the pool with the name (pool names are unique, see Validate)
+func (c *Config) poolByName(name string) *PoolConfig {
+	for num := range c.Pools {
+		if c.Pools[num].Name == name {
+			return &c.Pools[num]
+		}
+	}
+	return nil
+}
+
 func (valueMap *PoolConfigNodeValueMap) Entries() map[string]*string {
 	var mapList map[string]*string
 
@@ -63,6 +289,10 @@ func (valueMap *PoolConfigNodeValueMap) Entries() map[string]*string {
 	return mapList
 }
 
+func (valueMap PoolConfigNodeValueMap) MarshalYAML() (interface{}, error) {
+	return valueMap.Entries(), nil
+}
+
 func (valueMap *PoolConfigNodeValueMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	mapList := map[string]*string{}
 	err := unmarshal(&mapList)
@@ -85,57 +315,78 @@ func (valueMap *PoolConfigNodeValueMap) UnmarshalYAML(unmarshal func(interface{}
 	return nil
 }
 
-func (p *PoolConfig) IsMatchingNode(logger *zap.SugaredLogger, node *corev1.Node) (bool, error) {
-	for num, selector := range p.Selector {
-		// auto compile regexp
-		if selector.Regexp != nil {
-			selector.regexp = regexp.MustCompile(*selector.Regexp)
-			p.Selector[num].regexp = selector.regexp
-		}
-
-		// auto compile json path
-		if selector.jsonPath == nil {
-			selector.jsonPath = jsonpath.New(p.Name)
-			selector.jsonPath.AllowMissingKeys(true)
-			if err := selector.jsonPath.Parse(selector.Path); err != nil {
-				return false, err
-			}
-			p.Selector[num].jsonPath = selector.jsonPath
+// AsMap returns the pool configuration as map with the keys of the configuration file (can be serialized as json)
+func (p *PoolConfig) AsMap() (map[string]interface{}, error) {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &ret); err != nil {
+		return nil, err
+	}
+
+	return convertYamlMaps(ret).(map[string]interface{}), nil
+}
+
+// convertYamlMaps converts the map[interface{}]interface{} of yaml.v2 to map[string]interface{} recursively
+func convertYamlMaps(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[fmt.Sprint(key)] = convertYamlMaps(item)
 		}
+		return obj
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertYamlMaps(item)
+		}
+		return v
+	case []interface{}:
+		for num, item := range v {
+			v[num] = convertYamlMaps(item)
+		}
+		return v
+	}
+	return value
+}
 
-		values, err := selector.jsonPath.FindResults(node)
-		if err != nil {
-			return false, err
+// Compile compiles the selectors of all pools
+func (c *Config) Compile() error {
+	for num := range c.Pools {
+		if err := c.Pools[num].Compile(); err != nil {
+			return fmt.Errorf(`pool "%v": %w`, c.Pools[num].Name, err)
 		}
+	}
+	return nil
+}
 
-		if len(values) == 1 && len(values[0]) == 1 {
-			val := values[0][0].String()
-			selectorMatches := false
+// Compile compiles regexps and json paths of the pool selectors and checks the templated values
+func (p *PoolConfig) Compile() error {
+	if err := p.compileLabelSelectors(); err != nil {
+		return err
+	}
 
-			// compare value
-			if selector.Match != nil {
-				if strings.Compare(val, *selector.Match) == 0 {
-					selectorMatches = true
-				} else {
-					logger.Debugf("Node \"%s\": path \"%s\" with value \"%s\" is not matching value \"%s\"", node.Name, selector.Path, val, *selector.Match)
-				}
-			}
+	for num := range p.Selector {
+		if err := p.Selector[num].compile(p.Name); err != nil {
+			return err
+		}
+	}
 
-			// regexp
-			if selector.regexp != nil {
-				if selector.regexp.MatchString(val) {
-					selectorMatches = true
-				} else {
-					logger.Debugf("Node \"%s\": path \"%s\" with value \"%s\" is not matching regexp \"%s\"", node.Name, selector.Path, val, *selector.Regexp)
-				}
-			}
+	return p.compileTemplates()
+}
 
-			if !selectorMatches {
-				return false, nil
-			}
-		} else {
-			// not found -> not matching
-			logger.Debugf("Node \"%s\": path \"%s\" not found", node.Name, selector.Path)
+func (p *PoolConfig) IsMatchingNode(logger *zap.SugaredLogger, node *corev1.Node) (bool, error) {
+	results, err := p.evaluateSelectors(node, true)
+	if err != nil {
+		return false, err
+	}
+
+	for _, result := range results {
+		if !result.Matching {
+			logger.Debugf("Node \"%s\": %s %s", node.Name, result.Description(), result.Message)
 			return false, nil
 		}
 	}
@@ -143,7 +394,51 @@ func (p *PoolConfig) IsMatchingNode(logger *zap.SugaredLogger, node *corev1.Node
 	return true, nil
 }
 
-func (p *PoolConfig) CreateJsonPatchSet(node *corev1.Node) (patchSet *k8s.JsonPatchSet) {
+// evaluateSelectors evaluates labelSelector, fieldSelector and all selectors of the pool against the node,
+// with shortCircuit the evaluation stops at the first selector which is not matching
+func (p *PoolConfig) evaluateSelectors(node *corev1.Node, shortCircuit bool) ([]*SelectorResult, error) {
+	results := []*SelectorResult{}
+
+	labelResults, err := p.evaluateLabelSelectors(node)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range labelResults {
+		results = append(results, result)
+		if shortCircuit && !result.Matching {
+			return results, nil
+		}
+	}
+
+	for num := range p.Selector {
+		result, err := p.Selector[num].evaluate(p.Name, node, shortCircuit)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+		if shortCircuit && !result.Matching {
+			return results, nil
+		}
+	}
+
+	return results, nil
+}
+
+// CreateJsonPatchSet renders the templated values of the pool and creates the json patch set for the node
+func (p *PoolConfig) CreateJsonPatchSet(node *corev1.Node) (*k8s.JsonPatchSet, error) {
+	renderedPool, err := p.Render(node)
+	if err != nil {
+		return nil, err
+	}
+
+	patchSet := renderedPool.createJsonPatchSet(node)
+	addTaintsPrecondition(patchSet, node)
+	return patchSet, nil
+}
+
+func (p *PoolConfig) createJsonPatchSet(node *corev1.Node) (patchSet *k8s.JsonPatchSet) {
 	patchSet = k8s.NewJsonPatchSet()
 
 	// node roles
@@ -207,8 +502,21 @@ func (p *PoolConfig) CreateJsonPatchSet(node *corev1.Node) (patchSet *k8s.JsonPa
 		}
 	}
 
-	// custom patches
+	// node taints (merged with existing taints)
+	if taints, changed := p.Node.Taints.Apply(node.Spec.Taints); changed {
+		patchSet.Add(k8s.JsonPatchObject{
+			Op:    "add",
+			Path:  "/spec/taints",
+			Value: taints,
+		})
+	}
+
+	// custom patches, "test" operations are preconditions and only sent with other changes
 	for _, patch := range p.Node.JsonPatches {
+		if patch.Op == "test" {
+			patchSet.AddTest(patch)
+			continue
+		}
 		patchSet.Add(patch)
 	}
 
@@ -1,10 +1,19 @@
 package config
 
 import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/webdevops/kube-pool-manager/k8s"
 )
 
 var testLogger *zap.SugaredLogger
@@ -22,6 +31,9 @@ func buildNode() *corev1.Node {
 	node.ObjectMeta.Labels = map[string]string{
 		"node.kubernetes.io/role": "worker",
 	}
+	node.Status.Conditions = []corev1.NodeCondition{
+		{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady"},
+	}
 
 	return &node
 }
@@ -144,3 +156,1686 @@ func Test_NodeMultipleMatcher(t *testing.T) {
 		t.Error("Expected not matching, but matching node")
 	}
 }
+
+func buildPoolModeConfig(poolMode string) Config {
+	return Config{
+		PoolMode: poolMode,
+		Pools: []PoolConfig{
+			{
+				Name:     "worker",
+				Continue: true,
+				Selector: []PoolConfigSelector{
+					{
+						Path:  "{.metadata.labels.node\\.kubernetes\\.io/role}",
+						Match: stringPtr("worker"),
+					},
+				},
+				Node: PoolConfigNode{
+					Labels: PoolConfigNodeValueMap{entries: &map[string]*string{
+						"webdevops.io/pool":   stringPtr("worker"),
+						"webdevops.io/worker": stringPtr("true"),
+					}},
+				},
+			},
+			{
+				Name: "azure",
+				Selector: []PoolConfigSelector{
+					{
+						Path:   "{.spec.providerID}",
+						Regexp: stringPtr("^azure://.+$"),
+					},
+				},
+				Node: PoolConfigNode{
+					Labels: PoolConfigNodeValueMap{entries: &map[string]*string{
+						"webdevops.io/pool":  stringPtr("azure"),
+						"webdevops.io/azure": stringPtr("true"),
+					}},
+				},
+			},
+			{
+				Name: "fallback",
+				Selector: []PoolConfigSelector{
+					{
+						Path:   "{.spec.providerID}",
+						Regexp: stringPtr(".*"),
+					},
+				},
+				Node: PoolConfigNode{
+					Labels: PoolConfigNodeValueMap{entries: &map[string]*string{
+						"webdevops.io/pool": stringPtr("fallback"),
+					}},
+				},
+			},
+		},
+	}
+}
+
+func patchSetLabelValue(t *testing.T, patchSet *k8s.JsonPatchSet, label string) *string {
+	t.Helper()
+	patch, exists := patchSet.List["/metadata/labels/"+k8s.PatchPathEsacpe(label)]
+	if !exists {
+		return nil
+	}
+
+	patchString, ok := patch.(k8s.JsonPatchString)
+	if !ok {
+		t.Fatalf("Unexpected patch type %T for label \"%s\"", patch, label)
+	}
+	return patchString.Value
+}
+
+func Test_PoolModeAll(t *testing.T) {
+	node := buildNode()
+
+	conf := buildPoolModeConfig(PoolModeAll)
+	patchSet, poolNames, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(poolNames, []string{"worker", "azure", "fallback"}) {
+		t.Errorf("Expected all pools to match, got %v", poolNames)
+	}
+
+	if val := patchSetLabelValue(t, patchSet, "webdevops.io/pool"); val == nil || *val != "fallback" {
+		t.Errorf("Expected label to be overwritten by last matching pool, got %v", val)
+	}
+
+	for _, label := range []string{"webdevops.io/worker", "webdevops.io/azure"} {
+		if val := patchSetLabelValue(t, patchSet, label); val == nil || *val != "true" {
+			t.Errorf("Expected label \"%s\" to be merged into patch set", label)
+		}
+	}
+
+	// continue is ignored in mode all
+	conf.Pools[0].Continue = false
+	_, poolNames, _, err = conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(poolNames) != 3 {
+		t.Errorf("Expected continue to be ignored, got %v", poolNames)
+	}
+
+	// default mode
+	conf.PoolMode = ""
+	_, poolNames, _, err = conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(poolNames) != 3 {
+		t.Errorf("Expected mode all as default, got %v", poolNames)
+	}
+}
+
+func Test_PoolModeFirstMatch(t *testing.T) {
+	node := buildNode()
+
+	conf := buildPoolModeConfig(PoolModeFirstMatch)
+	patchSet, poolNames, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(poolNames, []string{"worker", "azure"}) {
+		t.Errorf("Expected evaluation to stop at pool \"azure\", got %v", poolNames)
+	}
+
+	if val := patchSetLabelValue(t, patchSet, "webdevops.io/pool"); val == nil || *val != "azure" {
+		t.Errorf("Expected label from pool \"azure\", got %v", val)
+	}
+
+	if val := patchSetLabelValue(t, patchSet, "webdevops.io/worker"); val == nil {
+		t.Error("Expected label from continued pool \"worker\" to be merged into patch set")
+	}
+
+	// first pool stops evaluation without continue
+	conf.Pools[0].Continue = false
+	patchSet, poolNames, _, err = conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(poolNames, []string{"worker"}) {
+		t.Errorf("Expected evaluation to stop at pool \"worker\", got %v", poolNames)
+	}
+	if val := patchSetLabelValue(t, patchSet, "webdevops.io/azure"); val != nil {
+		t.Error("Expected no label from pool \"azure\"")
+	}
+
+	// not matching pools do not stop evaluation
+	node.Labels = map[string]string{}
+	_, poolNames, _, err = conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(poolNames, []string{"azure"}) {
+		t.Errorf("Expected evaluation to stop at pool \"azure\", got %v", poolNames)
+	}
+}
+
+func Test_PoolModeInvalid(t *testing.T) {
+	conf := buildPoolModeConfig("foobar")
+	if _, _, _, err := conf.CreateJsonPatchSet(logger(), buildNode()); err == nil {
+		t.Error("Expected error for invalid poolMode")
+	}
+}
+
+func Test_NodeTaints(t *testing.T) {
+	node := buildNode()
+	node.Spec.Taints = []corev1.Taint{
+		{Key: "foreign", Value: "keep", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "old", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "other", Effect: corev1.TaintEffectNoExecute},
+		{Key: "legacy", Effect: corev1.TaintEffectPreferNoSchedule},
+	}
+
+	pool := PoolConfig{}
+	err := yaml.Unmarshal([]byte(`
+taints:
+  dedicated:NoSchedule: gpu
+  legacy:PreferNoSchedule: null
+  missing:NoSchedule: null
+  new:NoExecute: ""
+`), &pool.Node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, err := pool.CreateJsonPatchSet(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	patch, exists := patchSet.List["/spec/taints"]
+	if !exists {
+		t.Fatal("Expected taint patch")
+	}
+
+	expectedTaints := []corev1.Taint{
+		{Key: "foreign", Value: "keep", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "other", Effect: corev1.TaintEffectNoExecute},
+		{Key: "new", Value: "", Effect: corev1.TaintEffectNoExecute},
+	}
+	if taints := patch.(k8s.JsonPatchObject).Value; !reflect.DeepEqual(taints, expectedTaints) {
+		t.Errorf("Expected taints %v, got %v", expectedTaints, taints)
+	}
+
+	// existing node taints must not be modified
+	if node.Spec.Taints[1].Value != "old" {
+		t.Error("Expected node taints not to be modified")
+	}
+
+	// concurrent taint changes let the patch fail
+	if test, exists := patchSet.Tests["/spec/taints"]; !exists || !reflect.DeepEqual(test.(k8s.JsonPatchObject).Value, node.Spec.Taints) {
+		t.Errorf("Expected precondition for current taints, got %v", patchSet.Tests)
+	}
+
+	// no patch if nothing changes
+	node.Spec.Taints = expectedTaints
+	patchSet, err = pool.CreateJsonPatchSet(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, exists := patchSet.List["/spec/taints"]; exists {
+		t.Error("Expected no taint patch if taints are unchanged")
+	}
+	if len(patchSet.Tests) != 0 {
+		t.Errorf("Expected no precondition if taints are unchanged, got %v", patchSet.Tests)
+	}
+
+	// absence of taints is checked by resourceVersion
+	node.Spec.Taints = nil
+	node.ResourceVersion = "42"
+	patchSet, err = pool.CreateJsonPatchSet(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if test, exists := patchSet.Tests["/metadata/resourceVersion"]; !exists || test.(k8s.JsonPatchObject).Value != "42" {
+		t.Errorf("Expected resourceVersion precondition, got %v", patchSet.Tests)
+	}
+}
+
+func Test_NodeTaintsListFormat(t *testing.T) {
+	node := PoolConfigNode{}
+	err := yaml.Unmarshal([]byte(`
+taints:
+  - dedicated=gpu:NoSchedule
+  - maintenance:NoExecute
+`), &node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entries := node.Taints.Entries()
+	if val := entries["dedicated:NoSchedule"]; val == nil || *val != "gpu" {
+		t.Errorf("Expected taint \"dedicated:NoSchedule\" with value \"gpu\", got %v", val)
+	}
+	if val := entries["maintenance:NoExecute"]; val == nil || *val != "" {
+		t.Errorf("Expected taint \"maintenance:NoExecute\" with empty value, got %v", val)
+	}
+
+	for _, invalid := range []string{"taints: [dedicated=gpu]", "taints: [dedicated:Invalid]", "taints: {dedicated: gpu}"} {
+		if err := yaml.Unmarshal([]byte(invalid), &PoolConfigNode{}); err == nil {
+			t.Errorf("Expected error for invalid taint config \"%s\"", invalid)
+		}
+	}
+}
+
+func Test_NodeTaintsMultiplePools(t *testing.T) {
+	node := buildNode()
+	node.Spec.Taints = []corev1.Taint{
+		{Key: "foreign", Effect: corev1.TaintEffectNoSchedule},
+	}
+
+	conf := Config{}
+	err := yaml.Unmarshal([]byte(`
+pools:
+  - pool: first
+    selector:
+      - path: "{.metadata.labels.node\\.kubernetes\\.io/role}"
+        match: worker
+    node:
+      taints:
+        first:NoSchedule: "true"
+        removed:NoSchedule: "true"
+  - pool: second
+    selector:
+      - path: "{.metadata.labels.node\\.kubernetes\\.io/role}"
+        match: worker
+    node:
+      taints:
+        second:NoExecute: "true"
+        removed:NoSchedule: null
+`), &conf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, _, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedTaints := []corev1.Taint{
+		{Key: "foreign", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "first", Value: "true", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "second", Value: "true", Effect: corev1.TaintEffectNoExecute},
+	}
+	if taints := patchSet.List["/spec/taints"].(k8s.JsonPatchObject).Value; !reflect.DeepEqual(taints, expectedTaints) {
+		t.Errorf("Expected taints %v, got %v", expectedTaints, taints)
+	}
+}
+
+func Test_JsonPatchTestOperation(t *testing.T) {
+	conf, err := Parse([]byte(`pools:
+  - pool: custom
+    node:
+      labels:
+        webdevops.io/custom: "true"
+      jsonPatches:
+        - op: test
+          path: /metadata/labels/node.kubernetes.io~1role
+          value: worker
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	node := buildNode()
+	patchSet, _, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testPath := "/metadata/labels/node.kubernetes.io~1role"
+	if _, exists := patchSet.List[testPath]; exists {
+		t.Error("Expected test operation not to be a patch")
+	}
+	if _, exists := patchSet.Tests[testPath]; !exists {
+		t.Error("Expected test operation to be a precondition")
+	}
+
+	// test operations are sent with other changes
+	diffSet, err := patchSet.Diff(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diffSet.Len() == 0 || diffSet.Tests[testPath] == nil {
+		t.Errorf("Expected changes with precondition, got %v patches and %v preconditions", diffSet.Len(), len(diffSet.Tests))
+	}
+
+	// test operations alone are no change
+	managedKeys := patchSet.List["/metadata/annotations/"+k8s.PatchPathEsacpe(NodeAnnotationManagedKeys)].(k8s.JsonPatchString)
+	node.ObjectMeta.Labels["webdevops.io/custom"] = "true"
+	node.ObjectMeta.Annotations[NodeAnnotationManagedKeys] = *managedKeys.Value
+
+	diffSet, err = patchSet.Diff(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diffSet.Len() != 0 || len(diffSet.Tests) != 0 {
+		t.Errorf("Expected no changes, got %v patches and %v preconditions", diffSet.Len(), len(diffSet.Tests))
+	}
+}
+
+func Test_NodeManagedKeys(t *testing.T) {
+	node := buildNode()
+	node.ObjectMeta.Labels["webdevops.io/removed"] = "true"
+	node.ObjectMeta.Labels["webdevops.io/foreign"] = "true"
+	node.ObjectMeta.Labels["node-role.kubernetes.io/removed"] = ""
+	node.ObjectMeta.Annotations["webdevops.io/removed"] = "true"
+	node.ObjectMeta.Annotations[NodeAnnotationManagedKeys] = `{"labels":["node-role.kubernetes.io/removed","webdevops.io/gone","webdevops.io/kept","webdevops.io/removed"],"annotations":["webdevops.io/removed"],"taints":["removed:NoSchedule"]}`
+	node.Spec.Taints = []corev1.Taint{
+		{Key: "removed", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "foreign", Effect: corev1.TaintEffectNoSchedule},
+	}
+
+	conf := Config{}
+	err := yaml.Unmarshal([]byte(`
+pools:
+  - pool: worker
+    selector:
+      - path: "{.metadata.labels.node\\.kubernetes\\.io/role}"
+        match: worker
+    node:
+      roles: [worker]
+      labels:
+        webdevops.io/kept: "true"
+`), &conf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, _, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, path := range []string{
+		"/metadata/labels/webdevops.io~1removed",
+		"/metadata/labels/node-role.kubernetes.io~1removed",
+		"/metadata/annotations/webdevops.io~1removed",
+	} {
+		if patch, exists := patchSet.List[path]; !exists || patch.(k8s.JsonPatchString).Op != "remove" {
+			t.Errorf("Expected remove patch for \"%s\"", path)
+		}
+	}
+
+	// keys not managed or not existing must not be touched
+	for _, path := range []string{"/metadata/labels/webdevops.io~1foreign", "/metadata/labels/webdevops.io~1gone"} {
+		if _, exists := patchSet.List[path]; exists {
+			t.Errorf("Expected no patch for \"%s\"", path)
+		}
+	}
+
+	expectedTaints := []corev1.Taint{{Key: "foreign", Effect: corev1.TaintEffectNoSchedule}}
+	if taints := patchSet.List["/spec/taints"].(k8s.JsonPatchObject).Value; !reflect.DeepEqual(taints, expectedTaints) {
+		t.Errorf("Expected taints %v, got %v", expectedTaints, taints)
+	}
+
+	annotationPatch := patchSet.List["/metadata/annotations/"+k8s.PatchPathEsacpe(NodeAnnotationManagedKeys)].(k8s.JsonPatchString)
+	expectedAnnotation := `{"labels":["node-role.kubernetes.io/worker","webdevops.io/kept"],"pools":["worker"]}`
+	if annotationPatch.Value == nil || *annotationPatch.Value != expectedAnnotation {
+		t.Errorf("Expected managed keys annotation %v, got %v", expectedAnnotation, annotationPatch.Value)
+	}
+
+	// node not matching any pool anymore
+	node.ObjectMeta.Labels["node.kubernetes.io/role"] = "agent"
+	node.ObjectMeta.Labels["webdevops.io/kept"] = "true"
+	node.ObjectMeta.Annotations[NodeAnnotationManagedKeys] = *annotationPatch.Value
+	patchSet, _, _, err = conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, path := range []string{
+		"/metadata/labels/webdevops.io~1kept",
+		"/metadata/annotations/" + k8s.PatchPathEsacpe(NodeAnnotationManagedKeys),
+	} {
+		if patch, exists := patchSet.List[path]; !exists || patch.(k8s.JsonPatchString).Op != "remove" {
+			t.Errorf("Expected remove patch for \"%s\"", path)
+		}
+	}
+	if _, exists := patchSet.List["/metadata/labels/node-role.kubernetes.io~1worker"]; exists {
+		t.Error("Expected no patch for not existing role label")
+	}
+}
+
+func Test_BrokenPool(t *testing.T) {
+	node := buildNode()
+	node.ObjectMeta.Labels["webdevops.io/broken"] = "true"
+	node.ObjectMeta.Annotations[NodeAnnotationManagedKeys] = `{"labels":["webdevops.io/broken"]}`
+
+	conf := Config{}
+	err := yaml.Unmarshal([]byte(`
+pools:
+  - pool: first
+    node:
+      labels:
+        webdevops.io/first: "true"
+  - pool: broken
+    node:
+      labels:
+        webdevops.io/broken: "{{ .Node.Foobar }}"
+  - pool: last
+    node:
+      labels:
+        webdevops.io/last: "true"
+`), &conf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, poolNames, _, err := conf.CreateJsonPatchSet(logger(), node)
+	poolErrors, ok := AsPoolErrors(err)
+	if !ok {
+		t.Fatalf("Expected pool errors, got %v", err)
+	}
+	if !reflect.DeepEqual(poolErrors.Pools(), []string{"broken"}) {
+		t.Errorf("Expected pool \"broken\" to fail, got %v", poolErrors.Pools())
+	}
+	if !reflect.DeepEqual(poolNames, []string{"first", "last"}) {
+		t.Errorf("Expected other pools to be applied, got %v", poolNames)
+	}
+
+	for _, label := range []string{"webdevops.io/first", "webdevops.io/last"} {
+		if val := patchSetLabelValue(t, patchSet, label); val == nil || *val != "true" {
+			t.Errorf("Expected label \"%s\" to be set", label)
+		}
+	}
+
+	// managed keys of broken pools are kept
+	if _, exists := patchSet.List["/metadata/labels/webdevops.io~1broken"]; exists {
+		t.Error("Expected no patch for label of broken pool")
+	}
+
+	// with firstMatch the evaluation stops at a broken selector, keys of later pools are kept
+	node = buildNode()
+	node.ObjectMeta.Labels["webdevops.io/last"] = "true"
+	node.ObjectMeta.Annotations[NodeAnnotationManagedKeys] = `{"labels":["webdevops.io/last"]}`
+
+	firstMatchConf := Config{}
+	err = yaml.Unmarshal([]byte(`
+poolMode: firstMatch
+pools:
+  - pool: broken
+    selector:
+      - path: "{.spec.providerID"
+        match: "foobar"
+    node:
+      labels:
+        webdevops.io/broken: "true"
+  - pool: last
+    node:
+      labels:
+        webdevops.io/last: "true"
+`), &firstMatchConf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, poolNames, _, err = firstMatchConf.CreateJsonPatchSet(logger(), node)
+	poolErrors, ok = AsPoolErrors(err)
+	if !ok || !reflect.DeepEqual(poolErrors.Pools(), []string{"broken"}) {
+		t.Fatalf("Expected pool \"broken\" to fail, got %v", err)
+	}
+	if len(poolNames) != 0 {
+		t.Errorf("Expected no pools to be applied, got %v", poolNames)
+	}
+	if _, exists := patchSet.List["/metadata/labels/webdevops.io~1last"]; exists {
+		t.Error("Expected no patch for label of unevaluated pool")
+	}
+	if diffSet, err := patchSet.Diff(node); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if diffSet.Len() != 0 {
+		t.Errorf("Expected managed keys to be kept, got %v", diffSet.Summary())
+	}
+
+	// non pool errors are not reported as pool errors
+	conf.PoolMode = "foobar"
+	if _, _, _, err := conf.CreateJsonPatchSet(logger(), node); err == nil {
+		t.Error("Expected error for invalid poolMode")
+	} else if _, ok := AsPoolErrors(err); ok {
+		t.Errorf("Expected no pool errors, got %v", err)
+	}
+}
+
+func Test_SelectorConcurrentEvaluation(t *testing.T) {
+	node := buildNode()
+
+	pool := PoolConfig{
+		Name:          "concurrent",
+		LabelSelector: "node.kubernetes.io/role=worker",
+		Selector: []PoolConfigSelector{
+			{Path: "{.spec.providerID}", Regexp: stringPtr("/virtualMachineScaleSets/(?P<vmss>[^/]+)/")},
+			{AnyOf: []PoolConfigSelector{{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", Match: stringPtr("worker")}}},
+		},
+	}
+	if err := pool.Compile(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// compiled selectors are immutable and evaluated by multiple workers
+	var wg sync.WaitGroup
+	for num := 0; num < 8; num++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if matching, err := pool.IsMatchingNode(logger(), node); err != nil || !matching {
+					t.Errorf("Expected matching node, got %v (%v)", matching, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_NodePoolSpec(t *testing.T) {
+	spec := map[string]interface{}{
+		"priority": 10,
+		"continue": true,
+		"selector": []interface{}{
+			map[string]interface{}{
+				"path":  "{.metadata.labels.node\\.kubernetes\\.io/role}",
+				"match": "worker",
+			},
+		},
+		"node": map[string]interface{}{
+			"roles":  []interface{}{"worker"},
+			"labels": map[string]interface{}{"webdevops.io/removed": nil},
+		},
+	}
+
+	nodePool, err := ParseNodePoolSpec("nodepool", spec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if nodePool.Name != "nodepool" || nodePool.Priority != 10 || !nodePool.Continue {
+		t.Errorf("Unexpected NodePool spec: %v", nodePool)
+	}
+
+	if val, exists := nodePool.Node.Labels.Entries()["webdevops.io/removed"]; !exists || val != nil {
+		t.Error("Expected null label to be parsed")
+	}
+
+	matching, err := nodePool.IsMatchingNode(logger(), buildNode())
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !matching {
+		t.Error("Expected matching, but not matching node")
+	}
+
+	spec["selector"] = []interface{}{map[string]interface{}{"path": "{.spec.providerID}", "regexp": "("}}
+	if _, err := ParseNodePoolSpec("nodepool", spec); err == nil {
+		t.Error("Expected error for invalid regexp")
+	}
+}
+
+type crdSchema struct {
+	Properties            map[string]*crdSchema `yaml:"properties"`
+	Items                 *crdSchema            `yaml:"items"`
+	PreserveUnknownFields bool                  `yaml:"x-kubernetes-preserve-unknown-fields"`
+}
+
+// checkCrdSchema checks that every yaml field of the type is declared in the CRD schema (otherwise it would be pruned)
+func checkCrdSchema(t *testing.T, path string, fieldType reflect.Type, schema *crdSchema) {
+	t.Helper()
+
+	for fieldType.Kind() == reflect.Pointer || fieldType.Kind() == reflect.Slice {
+		if fieldType.Kind() == reflect.Slice {
+			if schema.Items == nil {
+				t.Errorf("Expected items for \"%s\" in CRD schema", path)
+				return
+			}
+			schema = schema.Items
+		}
+		fieldType = fieldType.Elem()
+	}
+
+	if fieldType.Kind() != reflect.Struct || schema.PreserveUnknownFields {
+		return
+	}
+
+	for num := 0; num < fieldType.NumField(); num++ {
+		field := fieldType.Field(num)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if options == "inline" {
+			checkCrdSchema(t, path, field.Type, schema)
+			continue
+		}
+
+		// pool name is the name of the NodePool object
+		if name == "" || name == "pool" {
+			continue
+		}
+
+		fieldSchema, exists := schema.Properties[name]
+		if !exists {
+			t.Errorf("Expected \"%s.%s\" to be declared in CRD schema", path, name)
+			continue
+		}
+		checkCrdSchema(t, path+"."+name, field.Type, fieldSchema)
+	}
+}
+
+func Test_NodePoolCrdSchema(t *testing.T) {
+	data, err := os.ReadFile("../deployment/crd.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	crd := struct {
+		Spec struct {
+			Versions []struct {
+				Schema struct {
+					OpenAPIV3Schema crdSchema `yaml:"openAPIV3Schema"`
+				} `yaml:"schema"`
+			} `yaml:"versions"`
+		} `yaml:"spec"`
+	}{}
+	if err := yaml.Unmarshal(data, &crd); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, version := range crd.Spec.Versions {
+		specSchema, exists := version.Schema.OpenAPIV3Schema.Properties["spec"]
+		if !exists {
+			t.Fatal("Expected spec in CRD schema")
+		}
+		checkCrdSchema(t, "spec", reflect.TypeOf(NodePoolSpec{}), specSchema)
+	}
+}
+
+func Test_PoolAsMap(t *testing.T) {
+	conf, err := Parse([]byte(`
+pools:
+  - pool: agents
+    selector:
+      - path: "{.spec.providerID}"
+        match: "azure"
+    node:
+      roles: [agent]
+      labels:
+        webdevops.io/removed: null
+      taints:
+        - dedicated=agents:NoSchedule
+      jsonPatches:
+        - op: replace
+          path: /spec/configSource
+          value:
+            configMap:
+              name: kubelet
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	poolMap, err := conf.Pools[0].AsMap()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(poolMap)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		`"pool":"agents"`,
+		`"match":"azure"`,
+		`"roles":{"agent":""}`,
+		`"labels":{"webdevops.io/removed":null}`,
+		`"taints":{"dedicated:NoSchedule":"agents"}`,
+		`"value":{"configMap":{"name":"kubelet"}}`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %v in pool json, got %v", expected, string(data))
+		}
+	}
+}
+
+func Test_ConfigWithNodePools(t *testing.T) {
+	conf := buildPoolModeConfig(PoolModeFirstMatch)
+
+	mergedConf := conf.WithNodePools([]*NodePoolSpec{
+		{Priority: 20, PoolConfig: PoolConfig{Name: "a"}},
+		{Priority: 10, PoolConfig: PoolConfig{Name: "c"}},
+		{Priority: 10, PoolConfig: PoolConfig{Name: "b"}},
+	})
+
+	poolNames := []string{}
+	for _, pool := range mergedConf.Pools {
+		poolNames = append(poolNames, pool.Name)
+	}
+
+	if !reflect.DeepEqual(poolNames, []string{"worker", "azure", "fallback", "b", "c", "a"}) {
+		t.Errorf("Unexpected pool order %v", poolNames)
+	}
+
+	if mergedConf.PoolMode != PoolModeFirstMatch || len(conf.Pools) != 3 {
+		t.Error("Expected original configuration to be unchanged")
+	}
+}
+
+func Test_Explain(t *testing.T) {
+	node := buildNode()
+
+	conf := buildPoolModeConfig(PoolModeFirstMatch)
+	conf.Pools[1].Selector = append(conf.Pools[1].Selector, PoolConfigSelector{
+		Path:  "{.metadata.labels.missing}",
+		Match: stringPtr("foobar"),
+	})
+
+	explanation := conf.Explain(node, "")
+	if explanation.Error != "" {
+		t.Fatalf("Unexpected error: %v", explanation.Error)
+	}
+
+	if !reflect.DeepEqual(explanation.MatchingPools, []string{"worker", "fallback"}) {
+		t.Errorf("Unexpected matching pools %v", explanation.MatchingPools)
+	}
+
+	azurePool := explanation.Pools[1]
+	if azurePool.Matching || !azurePool.Evaluated || len(azurePool.Selectors) != 2 {
+		t.Errorf("Expected all selectors of not matching pool to be evaluated, got %v", azurePool)
+	}
+	if !azurePool.Selectors[0].Matching || azurePool.Selectors[0].Value == nil || *azurePool.Selectors[0].Value != node.Spec.ProviderID {
+		t.Errorf("Unexpected selector result %v", azurePool.Selectors[0])
+	}
+	if azurePool.Selectors[1].Matching || azurePool.Selectors[1].Value != nil {
+		t.Errorf("Expected not found selector, got %v", azurePool.Selectors[1])
+	}
+
+	// explanation contains the same patch as sent by the manager
+	patchSet, _, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if patchSet, err = patchSet.Diff(node); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedPatch, _ := patchSet.Marshal()
+	if patch, _ := json.Marshal(explanation.Patch); len(explanation.Patch) == 0 || string(patch) != string(expectedPatch) {
+		t.Errorf("Expected json patch %s, got %s", expectedPatch, patch)
+	}
+
+	// pools after the first match without continue are not evaluated
+	conf.Pools[0].Continue = false
+	explanation = conf.Explain(node, "")
+	if !explanation.Pools[0].Evaluated || explanation.Pools[1].Evaluated || explanation.Pools[2].Evaluated {
+		t.Error("Expected only first pool to be evaluated")
+	}
+
+	// broken pools are reported by the pool explanation
+	conf.Pools[0].Selector = []PoolConfigSelector{{Path: "{.spec.providerID", Match: stringPtr("foobar")}}
+	explanation = conf.Explain(node, "")
+	if explanation.Error != "" || explanation.Pools[0].Error == "" || explanation.Pools[0].Matching {
+		t.Errorf("Expected error for broken pool, got %v", explanation.Pools[0])
+	}
+	if explanation.Pools[1].Evaluated || len(explanation.MatchingPools) != 0 {
+		t.Errorf("Expected evaluation to stop at broken pool, got %v", explanation.MatchingPools)
+	}
+}
+
+func Test_ExplainStartupTaint(t *testing.T) {
+	startupTaint := "kube-pool-manager.webdevops.io/unconfigured:NoSchedule"
+
+	node := buildNode()
+	node.Status.Conditions = nil
+	node.Spec.Taints = []corev1.Taint{
+		{Key: "kube-pool-manager.webdevops.io/unconfigured", Effect: corev1.TaintEffectNoSchedule},
+	}
+
+	conf, err := Parse([]byte(`pools:
+  - pool: worker
+    node:
+      taints:
+        dedicated:NoSchedule: "worker"
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// pool is gated until the node is ready, the startup taint is kept
+	explanation := conf.Explain(node, startupTaint)
+	if len(explanation.Patch) != 0 {
+		t.Errorf("Expected no patch for gated pool, got %v", explanation.Patch)
+	}
+
+	// precondition first, startup taint is removed with the pool taints
+	explanation = conf.WithStartupTaint().Explain(node, startupTaint)
+	if explanation.Error != "" {
+		t.Fatalf("Unexpected error: %v", explanation.Error)
+	}
+	if len(explanation.Patch) != 3 {
+		t.Fatalf("Expected precondition, managed keys and taints patch, got %v", explanation.Patch)
+	}
+
+	precondition := explanation.Patch[0].(k8s.JsonPatchObject)
+	if precondition.Op != "test" || precondition.Path != "/spec/taints" || !reflect.DeepEqual(precondition.Value, node.Spec.Taints) {
+		t.Errorf("Expected precondition on previous taints, got %v", precondition)
+	}
+
+	expectedTaints := []corev1.Taint{{Key: "dedicated", Value: "worker", Effect: corev1.TaintEffectNoSchedule}}
+	taints := explanation.Patch[2].(k8s.JsonPatchObject)
+	if taints.Path != "/spec/taints" || !reflect.DeepEqual(taints.Value, expectedTaints) {
+		t.Errorf("Expected taints %v, got %v", expectedTaints, taints)
+	}
+}
+
+func Test_ParseValidates(t *testing.T) {
+	for _, data := range []string{
+		"poolMode: foobar\npools: []",
+		"pools:\n  - pool: duplicate\n  - pool: duplicate",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Expected error for invalid configuration:\n%v", data)
+		}
+	}
+
+	if _, err := Parse([]byte("poolMode: firstMatch\npools:\n  - pool: valid")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// strict errors are only reported by strict validation
+	strictData := []byte(`pools:
+  - pool: strict
+    selector:
+      - path: "{.metadata.labels.foobar}"
+    node:
+      labels:
+        webdevops.io/invalid: "invalid value"
+      jsonPatches:
+        - op: foobar
+          path: /metadata/labels/foobar
+          value: barfoo
+`)
+	conf, err := Parse(strictData)
+	if err != nil {
+		t.Fatalf("Expected configuration with strict errors to be parsed, got %v", err)
+	}
+	if validationErrors := conf.Validate(); len(validationErrors) != 3 || len(validationErrors.Required()) != 0 {
+		t.Errorf("Expected 3 strict errors, got %v", validationErrors)
+	}
+	if validationErrors := Validate(strictData, "pools.yaml"); len(validationErrors) != 3 {
+		t.Errorf("Expected 3 errors with strict validation, got %v", validationErrors)
+	}
+}
+
+func Test_ValidateExample(t *testing.T) {
+	if err := ValidateFile("../example.yaml"); err != nil {
+		t.Errorf("Expected valid example config, got:\n%v", err)
+	}
+}
+
+func Test_ExplainExample(t *testing.T) {
+	conf, err := ParseFile("../example.yaml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	node := buildNode()
+	node.Name = "aks-agents-35471996-vmss00000u"
+	node.Labels["kubernetes.io/os"] = "linux"
+
+	explanation := conf.Explain(node, "")
+	if explanation.Error != "" {
+		t.Fatalf("Unexpected error: %v", explanation.Error)
+	}
+
+	expectedPools := []string{"linux", "azure", "agents", "agents-regexp"}
+	if !reflect.DeepEqual(explanation.MatchingPools, expectedPools) {
+		t.Errorf("Expected matching pools %v, got %v", expectedPools, explanation.MatchingPools)
+	}
+
+	vmssLabel := ""
+	for _, patch := range explanation.Patch {
+		if v, ok := patch.(k8s.JsonPatchString); ok && v.Path == "/metadata/labels/webdevops.io~1vmss" && v.Value != nil {
+			vmssLabel = *v.Value
+		}
+	}
+	if vmssLabel != "aks-agents-35471996-vmss" {
+		t.Errorf("Expected vmss label aks-agents-35471996-vmss, got %v", vmssLabel)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	validationErrors := Validate([]byte(`poolMode: foobar
+pools:
+  - pool: duplicate
+    selector:
+      - path: "{.spec.providerID}"
+    node:
+      role: [windows]
+  - pool: duplicate
+    selector:
+      - path: "{.spec.providerID"
+        regexp: "("
+    node:
+      labels:
+        "invalid key!": "invalid value!"
+      jsonPatches:
+        - op: invalid
+          path: /metadata/labels/foobar
+          value: barfoo
+`), "pools.yaml")
+
+	expectedErrors := []struct {
+		line int
+		path string
+	}{
+		{1, "poolMode"},
+		{5, "pools[0].selector[0]"},
+		{7, ""},
+		{8, "pools[1].pool"},
+		{10, "pools[1].selector[0].path"},
+		{11, "pools[1].selector[0].regexp"},
+		{14, "pools[1].node.labels.invalid key!"},
+		{14, "pools[1].node.labels.invalid key!"},
+		{16, "pools[1].node.jsonPatches[0].op"},
+	}
+
+	if len(validationErrors) != len(expectedErrors) {
+		t.Fatalf("Expected %v errors, got %v:\n%v", len(expectedErrors), len(validationErrors), validationErrors)
+	}
+
+	for num, expected := range expectedErrors {
+		validationError := validationErrors[num]
+		if validationError.File != "pools.yaml" || validationError.Line != expected.line || validationError.Path != expected.path {
+			t.Errorf("Expected error at line %v (%v), got %v", expected.line, expected.path, validationError)
+		}
+	}
+
+	if validationErrors := Validate([]byte("pools: [foo: bar"), "pools.yaml"); len(validationErrors) != 1 || validationErrors[0].Line == 0 {
+		t.Errorf("Expected syntax error with line, got %v", validationErrors)
+	}
+}
+
+func Test_JsonSchemaUpToDate(t *testing.T) {
+	schema, err := JsonSchema()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	shippedSchema, err := os.ReadFile("../pools.schema.json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if strings.TrimSpace(string(shippedSchema)) != string(schema) {
+		t.Error("pools.schema.json is outdated, run \"make schema\"")
+	}
+}
+
+func Test_NodeSelectorOperators(t *testing.T) {
+	node := buildNode()
+
+	testCases := []struct {
+		name     string
+		selector PoolConfigSelector
+		expected bool
+	}{
+		{"exists", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", Exists: true}, true},
+		{"exists missing", PoolConfigSelector{Path: "{.metadata.labels.missing}", Exists: true}, false},
+		{"notExists", PoolConfigSelector{Path: "{.metadata.labels.missing}", NotExists: true}, true},
+		{"notExists existing", PoolConfigSelector{Path: "{.metadata.annotations.node\\.kubernetes\\.io/foobar}", NotExists: true}, false},
+		{"in", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", In: []string{"agent", "worker"}}, true},
+		{"in not listed", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", In: []string{"agent", "master"}}, false},
+		{"in missing", PoolConfigSelector{Path: "{.metadata.labels.missing}", In: []string{"worker"}}, false},
+		{"notIn", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", NotIn: []string{"agent", "master"}}, true},
+		{"notIn listed", PoolConfigSelector{Path: "{.metadata.annotations.node\\.kubernetes\\.io/foobar}", NotIn: []string{"barfoo"}}, false},
+		{"notIn missing", PoolConfigSelector{Path: "{.metadata.labels.missing}", NotIn: []string{"worker"}}, true},
+		{"not match", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", Match: stringPtr("worker"), Not: true}, false},
+		{"not regexp", PoolConfigSelector{Path: "{.spec.providerID}", Regexp: stringPtr("^aws://"), Not: true}, true},
+		{"not exists", PoolConfigSelector{Path: "{.metadata.labels.missing}", Exists: true, Not: true}, true},
+		{"not in", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", In: []string{"worker"}, Not: true}, false},
+		{"combined operators", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", Exists: true, NotIn: []string{"worker"}}, false},
+		{"no operator", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}"}, false},
+	}
+
+	for _, testCase := range testCases {
+		pool := PoolConfig{
+			Name:     "testing",
+			Selector: []PoolConfigSelector{testCase.selector},
+		}
+
+		matching, err := pool.IsMatchingNode(logger(), node)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", testCase.name, err)
+		}
+		if matching != testCase.expected {
+			t.Errorf("%s: Expected matching=%v, got %v", testCase.name, testCase.expected, matching)
+		}
+	}
+}
+
+func Test_NodeSelectorGroups(t *testing.T) {
+	node := buildNode()
+
+	roleWorker := PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", Match: stringPtr("worker")}
+	roleAgent := PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", Match: stringPtr("agent")}
+	azure := PoolConfigSelector{Path: "{.spec.providerID}", Regexp: stringPtr("^azure://")}
+	aws := PoolConfigSelector{Path: "{.spec.providerID}", Regexp: stringPtr("^aws://")}
+
+	testCases := []struct {
+		name     string
+		selector PoolConfigSelector
+		expected bool
+	}{
+		{"anyOf", PoolConfigSelector{AnyOf: []PoolConfigSelector{roleAgent, roleWorker}}, true},
+		{"anyOf none matching", PoolConfigSelector{AnyOf: []PoolConfigSelector{roleAgent, aws}}, false},
+		{"allOf", PoolConfigSelector{AllOf: []PoolConfigSelector{roleWorker, azure}}, true},
+		{"allOf one not matching", PoolConfigSelector{AllOf: []PoolConfigSelector{roleWorker, aws}}, false},
+		{"noneOf", PoolConfigSelector{NoneOf: []PoolConfigSelector{roleAgent, aws}}, true},
+		{"noneOf one matching", PoolConfigSelector{NoneOf: []PoolConfigSelector{roleAgent, azure}}, false},
+		{"not anyOf", PoolConfigSelector{AnyOf: []PoolConfigSelector{roleAgent, roleWorker}, Not: true}, false},
+		{"nested", PoolConfigSelector{AllOf: []PoolConfigSelector{azure, {AnyOf: []PoolConfigSelector{roleAgent, roleWorker}}}}, true},
+		{"path and group", PoolConfigSelector{Path: "{.spec.providerID}", Regexp: stringPtr("^azure://"), NoneOf: []PoolConfigSelector{roleAgent}}, true},
+		{"path not matching and group", PoolConfigSelector{Path: "{.spec.providerID}", Regexp: stringPtr("^aws://"), NoneOf: []PoolConfigSelector{roleAgent}}, false},
+		{"empty anyOf", PoolConfigSelector{AnyOf: []PoolConfigSelector{}}, false},
+		{"empty", PoolConfigSelector{}, false},
+	}
+
+	for _, testCase := range testCases {
+		pool := PoolConfig{
+			Name:     "testing",
+			Selector: []PoolConfigSelector{testCase.selector},
+		}
+
+		if err := pool.Compile(); err != nil {
+			t.Fatalf("%s: Unexpected error: %v", testCase.name, err)
+		}
+
+		matching, err := pool.IsMatchingNode(logger(), node)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", testCase.name, err)
+		}
+		if matching != testCase.expected {
+			t.Errorf("%s: Expected matching=%v, got %v", testCase.name, testCase.expected, matching)
+		}
+	}
+
+	// explain evaluates all branches and reports the deciding one
+	result, err := (&PoolConfigSelector{AnyOf: []PoolConfigSelector{roleAgent, roleWorker, aws}}).evaluate("testing", node, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Matching || result.Group != SelectorGroupAnyOf || len(result.Children) != 3 {
+		t.Fatalf("Expected matching anyOf with 3 evaluated branches, got %+v", result)
+	}
+	if !strings.Contains(result.Message, "branch [1] matching") {
+		t.Errorf("Expected deciding branch [1] in message, got %q", result.Message)
+	}
+
+	validationErrors := Validate([]byte(`pools:
+  - pool: groups
+    selector:
+      - anyOf:
+          - path: "{.spec.providerID}"
+          - allOf: []
+      - match: foobar
+`), "pools.yaml")
+
+	expectedPaths := []string{
+		"pools[0].selector[0].anyOf[0]",
+		"pools[0].selector[0].anyOf[1].allOf",
+		"pools[0].selector[1]",
+	}
+	if len(validationErrors) != len(expectedPaths) {
+		t.Fatalf("Expected %v errors, got %v:\n%v", len(expectedPaths), len(validationErrors), validationErrors)
+	}
+	for num, expectedPath := range expectedPaths {
+		if validationErrors[num].Path != expectedPath {
+			t.Errorf("Expected error at %v, got %v", expectedPath, validationErrors[num])
+		}
+	}
+}
+
+func Test_NodeSelectorComparisons(t *testing.T) {
+	node := buildNode()
+	node.Status.Allocatable = corev1.ResourceList{
+		corev1.ResourceMemory:                 resource.MustParse("65843020Ki"),
+		corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("2"),
+	}
+	node.Status.NodeInfo.KubeletVersion = "v1.30.4"
+	node.Spec.Unschedulable = true
+
+	memoryPath := "{.status.allocatable.memory}"
+	gpuPath := "{.status.allocatable.nvidia\\.com/gpu}"
+	versionPath := "{.status.nodeInfo.kubeletVersion}"
+
+	testCases := []struct {
+		name     string
+		selector PoolConfigSelector
+		expected bool
+	}{
+		{"quantity gte", PoolConfigSelector{Path: memoryPath, Type: SelectorTypeQuantity, Gte: stringPtr("60Gi")}, true},
+		{"quantity gte too small", PoolConfigSelector{Path: memoryPath, Type: SelectorTypeQuantity, Gte: stringPtr("64Gi")}, false},
+		{"quantity range", PoolConfigSelector{Path: memoryPath, Type: SelectorTypeQuantity, Gt: stringPtr("32Gi"), Lt: stringPtr("128Gi")}, true},
+		{"quantity missing", PoolConfigSelector{Path: "{.status.allocatable.cpu}", Type: SelectorTypeQuantity, Gte: stringPtr("1")}, false},
+		{"int gt", PoolConfigSelector{Path: gpuPath, Gt: stringPtr("0")}, true},
+		{"int lte", PoolConfigSelector{Path: gpuPath, Type: SelectorTypeInt, Lte: stringPtr("1")}, false},
+		{"int not parsable", PoolConfigSelector{Path: memoryPath, Type: SelectorTypeInt, Gt: stringPtr("0")}, false},
+		{"semver gte", PoolConfigSelector{Path: versionPath, Type: SelectorTypeSemver, Gte: stringPtr("v1.30.0")}, true},
+		{"semver gte equal", PoolConfigSelector{Path: versionPath, Type: SelectorTypeSemver, Gte: stringPtr("1.30.4")}, true},
+		{"semver lt", PoolConfigSelector{Path: versionPath, Type: SelectorTypeSemver, Lt: stringPtr("v1.30.0")}, false},
+		{"semver lt minor", PoolConfigSelector{Path: versionPath, Type: SelectorTypeSemver, Lt: stringPtr("v1.31")}, true},
+		{"bool value", PoolConfigSelector{Path: "{.spec.unschedulable}", Match: stringPtr("true")}, true},
+	}
+
+	for _, testCase := range testCases {
+		pool := PoolConfig{
+			Name:     "testing",
+			Selector: []PoolConfigSelector{testCase.selector},
+		}
+
+		if err := pool.Compile(); err != nil {
+			t.Fatalf("%s: Unexpected error: %v", testCase.name, err)
+		}
+
+		matching, err := pool.IsMatchingNode(logger(), node)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", testCase.name, err)
+		}
+		if matching != testCase.expected {
+			t.Errorf("%s: Expected matching=%v, got %v", testCase.name, testCase.expected, matching)
+		}
+	}
+
+	invalidPool := PoolConfig{
+		Name:     "testing",
+		Selector: []PoolConfigSelector{{Path: memoryPath, Type: SelectorTypeQuantity, Gte: stringPtr("lots")}},
+	}
+	if err := invalidPool.Compile(); err == nil {
+		t.Errorf("Expected error for invalid quantity")
+	}
+
+	validationErrors := Validate([]byte(`pools:
+  - pool: comparisons
+    selector:
+      - path: "{.status.allocatable.memory}"
+        type: quantity
+        gte: lots
+      - path: "{.status.nodeInfo.kubeletVersion}"
+        type: version
+        gte: v1.30.0
+      - path: "{.status.nodeInfo.kubeletVersion}"
+        type: semver
+        gte: v1.30.0
+`), "pools.yaml")
+
+	expectedPaths := []string{
+		"pools[0].selector[0].gte",
+		"pools[0].selector[1].type",
+	}
+	if len(validationErrors) != len(expectedPaths) {
+		t.Fatalf("Expected %v errors, got %v:\n%v", len(expectedPaths), len(validationErrors), validationErrors)
+	}
+	for num, expectedPath := range expectedPaths {
+		if validationErrors[num].Path != expectedPath {
+			t.Errorf("Expected error at %v, got %v", expectedPath, validationErrors[num])
+		}
+	}
+}
+
+func Test_NodeLabelSelector(t *testing.T) {
+	node := buildNode()
+	node.Name = "aks-agents-35471996-vmss00000u"
+	node.Labels["kubernetes.io/os"] = "linux"
+	node.Labels["tier"] = "b"
+
+	testCases := []struct {
+		name          string
+		labelSelector string
+		fieldSelector string
+		selector      []PoolConfigSelector
+		expected      bool
+	}{
+		{"labelSelector", "kubernetes.io/os=linux,tier in (a,b)", "", nil, true},
+		{"labelSelector not matching", "kubernetes.io/os=linux,tier notin (a,b)", "", nil, false},
+		{"labelSelector exists", "node.kubernetes.io/role,!missing", "", nil, true},
+		{"fieldSelector", "", "metadata.name=aks-agents-35471996-vmss00000u", nil, true},
+		{"fieldSelector not equal", "", "metadata.name!=aks-agents-35471996-vmss00000u", nil, false},
+		{"fieldSelector unschedulable", "", "spec.unschedulable=false", nil, true},
+		{"combined", "kubernetes.io/os=linux", "metadata.name!=foobar", []PoolConfigSelector{{Path: "{.spec.providerID}", Regexp: stringPtr("^azure://")}}, true},
+		{"combined selector not matching", "kubernetes.io/os=linux", "", []PoolConfigSelector{{Path: "{.spec.providerID}", Regexp: stringPtr("^aws://")}}, false},
+	}
+
+	for _, testCase := range testCases {
+		pool := PoolConfig{
+			Name:          "testing",
+			LabelSelector: testCase.labelSelector,
+			FieldSelector: testCase.fieldSelector,
+			Selector:      testCase.selector,
+		}
+
+		if err := pool.Compile(); err != nil {
+			t.Fatalf("%s: Unexpected error: %v", testCase.name, err)
+		}
+
+		matching, err := pool.IsMatchingNode(logger(), node)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", testCase.name, err)
+		}
+		if matching != testCase.expected {
+			t.Errorf("%s: Expected matching=%v, got %v", testCase.name, testCase.expected, matching)
+		}
+	}
+
+	if err := (&PoolConfig{Name: "testing", FieldSelector: "spec.providerID=foobar"}).Compile(); err == nil {
+		t.Errorf("Expected error for unsupported field")
+	}
+
+	validationErrors := Validate([]byte(`pools:
+  - pool: selectors
+    labelSelector: "tier in (a"
+    fieldSelector: "status.phase=Running"
+`), "pools.yaml")
+
+	expectedPaths := []string{
+		"pools[0].labelSelector",
+		"pools[0].fieldSelector",
+	}
+	if len(validationErrors) != len(expectedPaths) {
+		t.Fatalf("Expected %v errors, got %v:\n%v", len(expectedPaths), len(validationErrors), validationErrors)
+	}
+	for num, expectedPath := range expectedPaths {
+		if validationErrors[num].Path != expectedPath {
+			t.Errorf("Expected error at %v, got %v", expectedPath, validationErrors[num])
+		}
+	}
+}
+
+func Test_CompareSemver(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"v1.30.0", "v1.30.0", 0},
+		{"v1.30.0-eks-a737599", "v1.30.0", 0},
+		{"v1.30.2-eks-a737599", "v1.30.0", 1},
+		{"v1.29.8-eks-a737599", "v1.30", -1},
+		{"v1.30.5-gke.1014001", "1.30.5", 0},
+		{"v1.30.5-gke.1014001", "v1.31.0", -1},
+		{"v1.31.1+k3s1", "v1.31", 1},
+	}
+
+	for _, testCase := range testCases {
+		result, err := compareSelectorValues(SelectorTypeSemver, testCase.a, testCase.b)
+		if err != nil {
+			t.Errorf("%v <=> %v: Unexpected error: %v", testCase.a, testCase.b, err)
+			continue
+		}
+		if result != testCase.expected {
+			t.Errorf("%v <=> %v: Expected %v, got %v", testCase.a, testCase.b, testCase.expected, result)
+		}
+	}
+
+	if _, err := compareSelectorValues(SelectorTypeSemver, "foobar", "v1.30.0"); err == nil {
+		t.Error("Expected error for invalid version")
+	}
+}
+
+func Test_NodeTemplates(t *testing.T) {
+	node := buildNode()
+	node.Name = "aks-agents-35471996-vmss00000u"
+	node.Status.NodeInfo.OSImage = "Ubuntu 22.04.4 LTS"
+
+	conf, err := Parse([]byte(`pools:
+  - pool: templates
+    selector:
+      - path: "{.spec.providerID}"
+        regexp: "/virtualMachineScaleSets/(?P<vmss>[^/]+)/virtualMachines/(?P<instance>[0-9]+)$"
+    node:
+      roles:
+        agent: "{{ .Groups.vmss }}"
+      labels:
+        webdevops.io/vmss: "{{ .Groups.vmss }}"
+        webdevops.io/os-image: "{{ .Node.Status.NodeInfo.OSImage }}"
+        webdevops.io/missing: "{{ .Groups.missing | default \"none\" }}"
+      annotations:
+        webdevops.io/os-image: "{{ .Node.Status.NodeInfo.OSImage }}"
+        webdevops.io/instance: "{{ .Pool }}/{{ .Groups.vmss }}/{{ .Groups.instance }}"
+      jsonPatches:
+        - op: replace
+          path: /metadata/labels/webdevops.io~1role
+          value: "{{ index .Node.Labels \"node.kubernetes.io/role\" | upper }}"
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, _, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedValues := map[string]string{
+		"/metadata/labels/node-role.kubernetes.io~1agent": "aks-agents-35471996-vmss",
+		"/metadata/labels/webdevops.io~1vmss":             "aks-agents-35471996-vmss",
+		"/metadata/labels/webdevops.io~1os-image":         "Ubuntu-22.04.4-LTS",
+		"/metadata/labels/webdevops.io~1missing":          "none",
+		"/metadata/annotations/webdevops.io~1os-image":    "Ubuntu 22.04.4 LTS",
+		"/metadata/annotations/webdevops.io~1instance":    "templates/aks-agents-35471996-vmss/30",
+		"/metadata/labels/webdevops.io~1role":             "WORKER",
+	}
+	for path, expectedValue := range expectedValues {
+		patch, exists := patchSet.List[path]
+		if !exists {
+			t.Errorf("Expected patch %v", path)
+			continue
+		}
+
+		var value interface{}
+		switch v := patch.(type) {
+		case k8s.JsonPatchString:
+			value = *v.Value
+		case k8s.JsonPatchObject:
+			value = v.Value
+		}
+		if value != expectedValue {
+			t.Errorf("Expected %v to be %q, got %q", path, expectedValue, value)
+		}
+	}
+
+	// the pool configuration itself must not be modified
+	if value := conf.Pools[0].Node.Labels.Entries()["webdevops.io/vmss"]; *value != "{{ .Groups.vmss }}" {
+		t.Errorf("Expected pool configuration not to be rendered, got %v", *value)
+	}
+
+	if _, err := Parse([]byte(`pools:
+  - pool: templates
+    node:
+      labels:
+        webdevops.io/vmss: "{{ .Groups.vmss "
+`)); err == nil {
+		t.Errorf("Expected error for invalid template")
+	}
+
+	validationErrors := Validate([]byte(`pools:
+  - pool: templates
+    node:
+      labels:
+        webdevops.io/vmss: "{{ .Groups.vmss }}"
+        webdevops.io/broken: "{{ .Groups.vmss "
+`), "pools.yaml")
+	if len(validationErrors) != 1 || validationErrors[0].Path != "pools[0].node.labels.webdevops.io/broken" {
+		t.Errorf("Expected one template error, got %v", validationErrors)
+	}
+}
+
+func Test_SanitizeLabelValue(t *testing.T) {
+	testCases := map[string]string{
+		"aks-agents-35471996-vmss":     "aks-agents-35471996-vmss",
+		"Ubuntu 22.04.4 LTS":           "Ubuntu-22.04.4-LTS",
+		"  --foo/bar--  ":              "foo-bar",
+		strings.Repeat("a", 70):        strings.Repeat("a", 63),
+		strings.Repeat("a", 62) + "-b": strings.Repeat("a", 62),
+		"":                             "",
+	}
+
+	for value, expected := range testCases {
+		if sanitized := SanitizeLabelValue(value); sanitized != expected {
+			t.Errorf("Expected %q to be sanitized to %q, got %q", value, expected, sanitized)
+		}
+	}
+}
+
+func Test_NodeSelectorProviderID(t *testing.T) {
+	node := buildNode()
+
+	testCases := []struct {
+		name     string
+		selector PoolConfigSelector
+		expected bool
+	}{
+		{"scaleSet", PoolConfigSelector{ProviderID: &PoolConfigSelectorProviderID{ScaleSet: "aks-agents-*"}}, true},
+		{"scaleSet not matching", PoolConfigSelector{ProviderID: &PoolConfigSelectorProviderID{ScaleSet: "aks-system-*"}}, false},
+		{"multiple fields", PoolConfigSelector{ProviderID: &PoolConfigSelectorProviderID{Provider: "azure", ResourceGroup: "mc_k8s_*", Instance: "3?"}}, true},
+		{"other provider", PoolConfigSelector{ProviderID: &PoolConfigSelectorProviderID{Provider: "aws"}}, false},
+		{"not", PoolConfigSelector{ProviderID: &PoolConfigSelectorProviderID{ScaleSet: "aks-system-*"}, Not: true}, true},
+		{"anyOf", PoolConfigSelector{AnyOf: []PoolConfigSelector{
+			{ProviderID: &PoolConfigSelectorProviderID{Provider: "aws"}},
+			{ProviderID: &PoolConfigSelectorProviderID{ScaleSet: "aks-agents-*"}},
+		}}, true},
+		{"path and providerID", PoolConfigSelector{Path: "{.metadata.labels.node\\.kubernetes\\.io/role}", Match: stringPtr("worker"), ProviderID: &PoolConfigSelectorProviderID{ScaleSet: "aks-system-*"}}, false},
+	}
+
+	for _, testCase := range testCases {
+		pool := PoolConfig{
+			Name:     "testing",
+			Selector: []PoolConfigSelector{testCase.selector},
+		}
+
+		if err := pool.Compile(); err != nil {
+			t.Fatalf("%s: Unexpected error: %v", testCase.name, err)
+		}
+
+		matching, err := pool.IsMatchingNode(logger(), node)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", testCase.name, err)
+		}
+		if matching != testCase.expected {
+			t.Errorf("%s: Expected matching=%v, got %v", testCase.name, testCase.expected, matching)
+		}
+	}
+
+	conf, err := Parse([]byte(`pools:
+  - pool: agents
+    selector:
+      - providerID:
+          scaleSet: "aks-agents-*"
+    node:
+      labels:
+        webdevops.io/vmss: "{{ .ProviderID.ScaleSet }}"
+        webdevops.io/resource-group: "{{ .ProviderID.ResourceGroup }}"
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, _, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value := patchSetLabelValue(t, patchSet, "webdevops.io/vmss"); value == nil || *value != "aks-agents-35471996-vmss" {
+		t.Errorf("Expected vmss label from providerID, got %v", value)
+	}
+	if value := patchSetLabelValue(t, patchSet, "webdevops.io/resource-group"); value == nil || *value != "mc_k8s_mblaschke_westeurope" {
+		t.Errorf("Expected resource group label from providerID, got %v", value)
+	}
+
+	validationErrors := Validate([]byte(`pools:
+  - pool: agents
+    selector:
+      - providerID: {}
+      - providerID:
+          scaleSet: "aks-[agents"
+      - providerID:
+          vmss: "aks-agents-*"
+`), "pools.yaml")
+
+	expectedPaths := []string{
+		"pools[0].selector[0].providerID",
+		"pools[0].selector[1].providerID",
+		"pools[0].selector[2].providerID",
+		"",
+	}
+	if len(validationErrors) != len(expectedPaths) {
+		t.Fatalf("Expected %v errors, got %v:\n%v", len(expectedPaths), len(validationErrors), validationErrors)
+	}
+	for num, expectedPath := range expectedPaths {
+		if validationErrors[num].Path != expectedPath {
+			t.Errorf("Expected error at %v, got %v", expectedPath, validationErrors[num])
+		}
+	}
+}
+
+func Test_AddTaintRemovalPatch(t *testing.T) {
+	startupTaint := "kube-pool-manager.webdevops.io/unconfigured:NoSchedule"
+
+	node := buildNode()
+	node.Spec.Taints = []corev1.Taint{
+		{Key: "kube-pool-manager.webdevops.io/unconfigured", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "foreign", Value: "keep", Effect: corev1.TaintEffectNoSchedule},
+	}
+
+	if hasTaint, err := NodeHasTaint(node, startupTaint); err != nil || !hasTaint {
+		t.Fatalf("Expected node to have startup taint (err: %v)", err)
+	}
+
+	conf, err := Parse([]byte(`pools:
+  - pool: worker
+    node:
+      taints:
+        dedicated:NoSchedule: worker
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	patchSet, _, _, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := AddTaintRemovalPatch(patchSet, node, startupTaint); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedTaints := []corev1.Taint{
+		{Key: "foreign", Value: "keep", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "worker", Effect: corev1.TaintEffectNoSchedule},
+	}
+	if taints := patchSet.List["/spec/taints"].(k8s.JsonPatchObject).Value; !reflect.DeepEqual(taints, expectedTaints) {
+		t.Errorf("Expected taints %v, got %v", expectedTaints, taints)
+	}
+
+	// no patch if node doesn't have the startup taint
+	node.Spec.Taints = expectedTaints
+	patchSet = k8s.NewJsonPatchSet()
+	if err := AddTaintRemovalPatch(patchSet, node, startupTaint); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if patchSet.Len() != 0 {
+		t.Errorf("Expected no patch, got %v", patchSet.List)
+	}
+
+	if err := AddTaintRemovalPatch(patchSet, node, "missing-effect"); err == nil {
+		t.Errorf("Expected error for invalid taint")
+	}
+}
+
+func Test_ReadinessGate(t *testing.T) {
+	node := buildNode()
+	node.Status.Conditions = []corev1.NodeCondition{
+		{Type: corev1.NodeReady, Status: corev1.ConditionFalse, Reason: "KubeletNotReady"},
+		{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionFalse, Reason: "RouteCreated"},
+	}
+
+	conf, err := Parse([]byte(`pools:
+  - pool: default
+    node:
+      labels:
+        webdevops.io/default: "true"
+  - pool: immediate
+    readinessGate:
+      immediate: true
+    node:
+      labels:
+        webdevops.io/immediate: "true"
+  - pool: network
+    readinessGate:
+      conditions:
+        - type: NetworkUnavailable
+          status: "False"
+    node:
+      labels:
+        webdevops.io/network: "true"
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	readyPools, gatedPools, err := conf.MatchingPoolsByReadiness(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(readyPools) != 2 || readyPools[0].Name != "immediate" || readyPools[1].Name != "network" {
+		t.Errorf("Expected pools immediate and network to be ready, got %v", readyPools)
+	}
+	if len(gatedPools) != 1 || gatedPools[0].Name != "default" {
+		t.Errorf("Expected pool default to be gated, got %v", gatedPools)
+	}
+
+	// keys of gated pools which were managed before are kept
+	node.Labels["webdevops.io/default"] = "true"
+	node.Annotations[NodeAnnotationManagedKeys] = `{"labels":["webdevops.io/default"]}`
+
+	patchSet, poolNames, gatedPoolNames, err := conf.CreateJsonPatchSet(logger(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(poolNames, []string{"immediate", "network"}) {
+		t.Errorf("Expected applied pools immediate and network, got %v", poolNames)
+	}
+	if !reflect.DeepEqual(gatedPoolNames, []string{"default"}) {
+		t.Errorf("Expected gated pool default, got %v", gatedPoolNames)
+	}
+	if value := patchSetLabelValue(t, patchSet, "webdevops.io/default"); value != nil {
+		t.Errorf("Expected no patch for label of gated pool, got %v", *value)
+	}
+	if value := patchSetLabelValue(t, patchSet, "webdevops.io/immediate"); value == nil || *value != "true" {
+		t.Errorf("Expected label of immediate pool, got %v", value)
+	}
+
+	managedKeys := patchSet.List["/metadata/annotations/"+k8s.PatchPathEsacpe(NodeAnnotationManagedKeys)].(k8s.JsonPatchString)
+	if !strings.Contains(*managedKeys.Value, "webdevops.io/default") {
+		t.Errorf("Expected managed label of gated pool to be kept, got %v", *managedKeys.Value)
+	}
+
+	// kubelet ready opens the default readiness gate
+	node.Status.Conditions[0] = corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady"}
+	if _, gatedPools, _ := conf.MatchingPoolsByReadiness(logger(), node); len(gatedPools) != 0 {
+		t.Errorf("Expected no gated pools, got %v", gatedPools)
+	}
+
+	// global readiness gate
+	conf.ReadinessGate = &ReadinessGate{Conditions: []ReadinessGateCondition{{Type: "example.com/CustomCondition", Status: "True"}}}
+	if readyPools, _, _ := conf.MatchingPoolsByReadiness(logger(), node); len(readyPools) != 2 {
+		t.Errorf("Expected global readiness gate to hold back pool default, got %v", readyPools)
+	}
+
+	validationErrors := Validate([]byte(`readinessGate:
+  immediate: true
+  conditions:
+    - type: Ready
+pools:
+  - pool: invalid
+    readinessGate:
+      conditions:
+        - status: "yes"
+`), "pools.yaml")
+
+	expectedPaths := []string{
+		"readinessGate.conditions",
+		"pools[0].readinessGate.conditions[0]",
+		"pools[0].readinessGate.conditions[0].status",
+	}
+	if len(validationErrors) != len(expectedPaths) {
+		t.Fatalf("Expected %v errors, got %v:\n%v", len(expectedPaths), len(validationErrors), validationErrors)
+	}
+	for num, expectedPath := range expectedPaths {
+		if validationErrors[num].Path != expectedPath {
+			t.Errorf("Expected error at %v, got %v", expectedPath, validationErrors[num])
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+type (
+	// NodeExplanation describes how the pools are evaluated for a node and which patch would be sent
+	NodeExplanation struct {
+		Node          string             `json:"node"`
+		Pools         []*PoolExplanation `json:"pools"`
+		MatchingPools []string           `json:"matchingPools"`
+		Patch         []k8s.JsonPatch    `json:"patch"`
+		Error         string             `json:"error,omitempty"`
+	}
+
+	PoolExplanation struct {
+		Name          string            `json:"name"`
+		Evaluated     bool              `json:"evaluated"`
+		Matching      bool              `json:"matching"`
+		Ready         bool              `json:"ready"`
+		ReadinessGate string            `json:"readinessGate"`
+		Selectors     []*SelectorResult `json:"selectors"`
+		Error         string            `json:"error,omitempty"`
+	}
+)
+
+// Explain evaluates all selectors of all pools against the node (without short circuit) and builds the
+// json patch which would be sent to the node (including preconditions and the removal of the startup taint,
+// an empty startupTaint disables the removal). Each pool is evaluated once and nothing is logged
+func (c *Config) Explain(node *corev1.Node, startupTaint string) *NodeExplanation {
+	explanation := &NodeExplanation{
+		Node:          node.Name,
+		Pools:         []*PoolExplanation{},
+		MatchingPools: []string{},
+		Patch:         []k8s.JsonPatch{},
+	}
+
+	// broken pools are reported by the pool explanations
+	logger := zap.NewNop().Sugar()
+
+	poolExplanations := map[*PoolConfig]*PoolExplanation{}
+	for num := range c.Pools {
+		poolConfig := &c.Pools[num]
+		poolExplanation := &PoolExplanation{
+			Name:      poolConfig.Name,
+			Selectors: []*SelectorResult{},
+			Matching:  true,
+		}
+
+		results, err := poolConfig.evaluateSelectors(node, false)
+		if err != nil {
+			poolExplanation.Error = err.Error()
+			poolExplanation.Matching = false
+		}
+
+		for _, result := range results {
+			poolExplanation.Selectors = append(poolExplanation.Selectors, result)
+			if !result.Matching {
+				poolExplanation.Matching = false
+			}
+		}
+
+		poolExplanation.Ready, poolExplanation.ReadinessGate = poolConfig.GetReadinessGate(c.GetReadinessGate()).IsOpen(node)
+
+		explanation.Pools = append(explanation.Pools, poolExplanation)
+		poolExplanations[poolConfig] = poolExplanation
+	}
+
+	// pools are matched in the order of the poolMode (eg. firstMatch stops at the first matching pool) using the results from above
+	matchingPools, err := c.matchingPools(logger, func(poolConfig *PoolConfig, poolLogger *zap.SugaredLogger) (bool, error) {
+		poolExplanation := poolExplanations[poolConfig]
+		poolExplanation.Evaluated = true
+		if poolExplanation.Error != "" {
+			// the full evaluation can fail on selectors which are skipped by the short circuit evaluation
+			return poolConfig.IsMatchingNode(poolLogger, node)
+		}
+		return poolExplanation.Matching, nil
+	})
+	if _, ok := AsPoolErrors(err); err != nil && !ok {
+		explanation.Error = err.Error()
+		return explanation
+	}
+
+	patchSet, poolNameList, gatedPoolNameList, err := c.createJsonPatchSet(logger, node, matchingPools, err)
+	poolErrors, _ := AsPoolErrors(err)
+	if len(poolErrors) > 0 {
+		for _, poolError := range poolErrors {
+			if poolExplanation := poolExplanations[c.poolByName(poolError.Pool)]; poolExplanation != nil && poolExplanation.Error == "" {
+				poolExplanation.Error = poolError.Err.Error()
+				poolExplanation.Matching = false
+			}
+		}
+	}
+	explanation.MatchingPools = poolNameList
+
+	// the startup taint is removed with the same patch after all pools are applied
+	if startupTaint != "" && len(gatedPoolNameList) == 0 && len(poolErrors) == 0 {
+		if err := AddTaintRemovalPatch(patchSet, node, startupTaint); err != nil {
+			explanation.Error = err.Error()
+			return explanation
+		}
+	}
+
+	patchSet, err = patchSet.Diff(node)
+	if err != nil {
+		explanation.Error = err.Error()
+		return explanation
+	}
+	explanation.Patch = patchSet.Operations()
+
+	return explanation
+}
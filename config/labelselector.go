@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// NodeFieldSelectorFields are the node fields supported by fieldSelector (same as the kubernetes api)
+var NodeFieldSelectorFields = []string{"metadata.name", "spec.unschedulable"}
+
+// compileLabelSelectors parses labelSelector and fieldSelector of the pool
+func (p *PoolConfig) compileLabelSelectors() error {
+	labelSelector, fieldSelector, err := p.labelSelectors()
+	if err != nil {
+		return err
+	}
+
+	p.labelSelector = labelSelector
+	p.fieldSelector = fieldSelector
+	return nil
+}
+
+// labelSelectors returns the parsed labelSelector and fieldSelector of the pool (nil if not set),
+// pools which were not compiled (eg. created in code) are parsed for each evaluation
+func (p *PoolConfig) labelSelectors() (labelSelector labels.Selector, fieldSelector fields.Selector, err error) {
+	labelSelector = p.labelSelector
+	if p.LabelSelector != "" && labelSelector == nil {
+		if labelSelector, err = labels.Parse(p.LabelSelector); err != nil {
+			return nil, nil, fmt.Errorf(`labelSelector "%v": %w`, p.LabelSelector, err)
+		}
+	}
+
+	fieldSelector = p.fieldSelector
+	if p.FieldSelector != "" && fieldSelector == nil {
+		if fieldSelector, err = parseNodeFieldSelector(p.FieldSelector); err != nil {
+			return nil, nil, fmt.Errorf(`fieldSelector "%v": %w`, p.FieldSelector, err)
+		}
+	}
+
+	return labelSelector, fieldSelector, nil
+}
+
+// parseNodeFieldSelector parses the field selector and checks if only supported node fields are used
+func parseNodeFieldSelector(selector string) (fields.Selector, error) {
+	fieldSelector, err := fields.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, requirement := range fieldSelector.Requirements() {
+		if !ContainsKey(NodeFieldSelectorFields, requirement.Field) {
+			return nil, fmt.Errorf(`field "%v" is not supported, expected one of %v`, requirement.Field, strings.Join(NodeFieldSelectorFields, ", "))
+		}
+	}
+
+	return fieldSelector, nil
+}
+
+// nodeFields returns the node fields for fieldSelector
+func nodeFields(node *corev1.Node) fields.Set {
+	return fields.Set{
+		"metadata.name":      node.Name,
+		"spec.unschedulable": strconv.FormatBool(node.Spec.Unschedulable),
+	}
+}
+
+// evaluateLabelSelectors evaluates labelSelector and fieldSelector of the pool against the node
+func (p *PoolConfig) evaluateLabelSelectors(node *corev1.Node) ([]*SelectorResult, error) {
+	results := []*SelectorResult{}
+
+	labelSelector, fieldSelector, err := p.labelSelectors()
+	if err != nil {
+		return nil, err
+	}
+
+	if labelSelector != nil {
+		result := &SelectorResult{
+			Group:    SelectorGroupLabelSelector,
+			Selector: p.LabelSelector,
+			Matching: true,
+			Message:  "labels are matching",
+		}
+
+		nodeLabels := labels.Set(node.Labels)
+		requirements, _ := labelSelector.Requirements()
+		for _, requirement := range requirements {
+			if !requirement.Matches(nodeLabels) {
+				result.Matching = false
+				result.Message = fmt.Sprintf("requirement \"%s\" is not matching", requirement.String())
+				break
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	if fieldSelector != nil {
+		result := &SelectorResult{
+			Group:    SelectorGroupFieldSelector,
+			Selector: p.FieldSelector,
+			Matching: true,
+			Message:  "fields are matching",
+		}
+
+		nodeFieldSet := nodeFields(node)
+		for _, requirement := range fieldSelector.Requirements() {
+			value := nodeFieldSet.Get(requirement.Field)
+
+			matching := value == requirement.Value
+			if requirement.Operator == selection.NotEquals {
+				matching = !matching
+			}
+
+			if !matching {
+				result.Matching = false
+				result.Message = fmt.Sprintf("requirement \"%s%s%s\" is not matching (value \"%s\")", requirement.Field, requirement.Operator, requirement.Value, value)
+				break
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
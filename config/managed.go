@@ -0,0 +1,208 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+const (
+	// NodeAnnotationManagedKeys stores the labels, annotations and taints which are owned by kube-pool-manager
+	NodeAnnotationManagedKeys = "kube-pool-manager.webdevops.io/managed-keys"
+)
+
+type (
+	NodeManagedKeys struct {
+		Labels      []string `json:"labels,omitempty"`
+		Annotations []string `json:"annotations,omitempty"`
+		Taints      []string `json:"taints,omitempty"`
+
+		// Pools which were applied to the node (used to detect nodes leaving a pool)
+		Pools []string `json:"pools,omitempty"`
+	}
+
+	managedKeySet map[string]bool
+)
+
+// ParseNodeManagedKeys parses the managed keys annotation of the node
+func ParseNodeManagedKeys(node *corev1.Node) (*NodeManagedKeys, error) {
+	managedKeys := &NodeManagedKeys{}
+
+	if val, exists := node.Annotations[NodeAnnotationManagedKeys]; exists && val != "" {
+		if err := json.Unmarshal([]byte(val), managedKeys); err != nil {
+			return managedKeys, fmt.Errorf(`unable to parse annotation "%v": %w`, NodeAnnotationManagedKeys, err)
+		}
+	}
+
+	return managedKeys, nil
+}
+
+// IsEmpty returns true if no keys are managed
+func (managedKeys *NodeManagedKeys) IsEmpty() bool {
+	return len(managedKeys.Labels) == 0 && len(managedKeys.Annotations) == 0 && len(managedKeys.Taints) == 0 && len(managedKeys.Pools) == 0
+}
+
+// buildNodeManagedKeys collects all keys which are set by the pools,
+// later pools can remove taints by setting them to null (taints are merged in order of the pools)
+func buildNodeManagedKeys(pools []*PoolConfig) *NodeManagedKeys {
+	labels := managedKeySet{}
+	annotations := managedKeySet{}
+	taints := managedKeySet{}
+
+	for _, poolConfig := range pools {
+		for roleName, roleValue := range poolConfig.Node.Roles.Entries() {
+			label := fmt.Sprintf("node-role.kubernetes.io/%s", roleName)
+			labels[label] = labels[label] || roleValue != nil
+		}
+
+		for labelName, labelValue := range poolConfig.Node.Labels.Entries() {
+			labels[labelName] = labels[labelName] || labelValue != nil
+		}
+
+		for annotationName, annotationValue := range poolConfig.Node.Annotations.Entries() {
+			annotations[annotationName] = annotations[annotationName] || annotationValue != nil
+		}
+
+		for taint, taintValue := range poolConfig.Node.Taints.Entries() {
+			taints[taint] = taintValue != nil
+		}
+	}
+
+	return &NodeManagedKeys{
+		Labels:      labels.list(),
+		Annotations: annotations.list(),
+		Taints:      taints.list(),
+	}
+}
+
+func poolNames(pools []*PoolConfig) []string {
+	ret := []string{}
+	for _, poolConfig := range pools {
+		ret = append(ret, poolConfig.Name)
+	}
+	return ret
+}
+
+// list returns the sorted list of keys which are set
+func (keySet managedKeySet) list() []string {
+	ret := []string{}
+	for key, managed := range keySet {
+		if managed {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ContainsKey returns true if the list contains the key
+func ContainsKey(list []string, key string) bool {
+	for _, val := range list {
+		if val == key {
+			return true
+		}
+	}
+	return false
+}
+
+// addManagedKeysPatches removes keys which were managed before but are no longer desired and updates the managed keys annotation
+// keys not listed in the managed keys annotation of the node are never touched
+func addManagedKeysPatches(logger *zap.SugaredLogger, node *corev1.Node, patchSet *k8s.JsonPatchSet, pools, retainedPools []*PoolConfig) {
+	previousKeys, err := ParseNodeManagedKeys(node)
+	if err != nil {
+		logger.Warnf("ignoring managed keys of node \"%s\": %v", node.Name, err)
+	}
+	desiredKeys := buildNodeManagedKeys(pools)
+
+	// previously managed keys of retained pools (eg. waiting for readiness gate) are kept
+	retainedKeys := buildNodeManagedKeys(retainedPools)
+	retain := func(desired, retained, previous []string) []string {
+		keySet := managedKeySet{}
+		for _, key := range desired {
+			keySet[key] = true
+		}
+		for _, key := range retained {
+			if ContainsKey(previous, key) {
+				keySet[key] = true
+			}
+		}
+		return keySet.list()
+	}
+	desiredKeys.Labels = retain(desiredKeys.Labels, retainedKeys.Labels, previousKeys.Labels)
+	desiredKeys.Annotations = retain(desiredKeys.Annotations, retainedKeys.Annotations, previousKeys.Annotations)
+	desiredKeys.Taints = retain(desiredKeys.Taints, retainedKeys.Taints, previousKeys.Taints)
+	desiredKeys.Pools = retain(poolNames(pools), poolNames(retainedPools), previousKeys.Pools)
+
+	// labels (including roles)
+	for _, label := range previousKeys.Labels {
+		if ContainsKey(desiredKeys.Labels, label) {
+			continue
+		}
+
+		path := fmt.Sprintf("/metadata/labels/%s", k8s.PatchPathEsacpe(label))
+		if _, exists := node.Labels[label]; exists {
+			if _, patched := patchSet.List[path]; !patched {
+				logger.Infof("removing no longer managed label \"%s\" from node \"%s\"", label, node.Name)
+				patchSet.Add(k8s.JsonPatchString{Op: "remove", Path: path})
+			}
+		}
+	}
+
+	// annotations
+	for _, annotation := range previousKeys.Annotations {
+		if ContainsKey(desiredKeys.Annotations, annotation) {
+			continue
+		}
+
+		path := fmt.Sprintf("/metadata/annotations/%s", k8s.PatchPathEsacpe(annotation))
+		if _, exists := node.Annotations[annotation]; exists {
+			if _, patched := patchSet.List[path]; !patched {
+				logger.Infof("removing no longer managed annotation \"%s\" from node \"%s\"", annotation, node.Name)
+				patchSet.Add(k8s.JsonPatchString{Op: "remove", Path: path})
+			}
+		}
+	}
+
+	// taints
+	removedTaints := map[string]*string{}
+	for _, taint := range previousKeys.Taints {
+		if !ContainsKey(desiredKeys.Taints, taint) {
+			if _, _, err := parseTaintKey(taint); err == nil {
+				removedTaints[taint] = nil
+			}
+		}
+	}
+	if len(removedTaints) > 0 {
+		taintMap := PoolConfigNodeTaintMap{entries: &removedTaints}
+		if taints, changed := taintMap.Apply(node.Spec.Taints); changed {
+			logger.Infof("removing no longer managed taints from node \"%s\"", node.Name)
+			patchSet.Add(k8s.JsonPatchObject{
+				Op:    "add",
+				Path:  "/spec/taints",
+				Value: taints,
+			})
+		}
+	}
+
+	// managed keys annotation
+	annotationPath := fmt.Sprintf("/metadata/annotations/%s", k8s.PatchPathEsacpe(NodeAnnotationManagedKeys))
+	if desiredKeys.IsEmpty() {
+		if _, exists := node.Annotations[NodeAnnotationManagedKeys]; exists {
+			patchSet.Add(k8s.JsonPatchString{Op: "remove", Path: annotationPath})
+		}
+	} else {
+		annotationValue, err := json.Marshal(desiredKeys)
+		if err != nil {
+			logger.Warnf("unable to build managed keys annotation for node \"%s\": %v", node.Name, err)
+			return
+		}
+
+		value := string(annotationValue)
+		patchSet.Add(k8s.JsonPatchString{Op: "replace", Path: annotationPath, Value: &value})
+	}
+}
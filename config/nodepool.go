@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+type (
+	// NodePoolSpec is the spec of the NodePool CustomResourceDefinition
+	NodePoolSpec struct {
+		Priority   int `yaml:"priority"`
+		PoolConfig `yaml:",inline"`
+	}
+)
+
+// ParseNodePoolSpec parses the spec of a NodePool object (pool name is taken from the object name)
+func ParseNodePoolSpec(name string, spec map[string]interface{}) (*NodePoolSpec, error) {
+	// convert to yaml to use the same parsing as the configuration file
+	specJson, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	specYaml, err := sigsyaml.JSONToYAML(specJson)
+	if err != nil {
+		return nil, err
+	}
+
+	nodePool := &NodePoolSpec{}
+	if err := yaml.Unmarshal(specYaml, nodePool); err != nil {
+		return nil, err
+	}
+	nodePool.Name = name
+
+	if validationErrors := nodePool.Validate(); len(validationErrors) > 0 {
+		return nil, fmt.Errorf(`pool "%v": %w`, name, validationErrors)
+	}
+
+	if err := nodePool.Compile(); err != nil {
+		return nil, fmt.Errorf(`pool "%v": %w`, name, err)
+	}
+
+	return nodePool, nil
+}
+
+// WithNodePools returns a copy of the configuration with the NodePools appended (ordered by priority and name)
+func (c *Config) WithNodePools(nodePools []*NodePoolSpec) *Config {
+	sortedNodePools := make([]*NodePoolSpec, len(nodePools))
+	copy(sortedNodePools, nodePools)
+	sort.SliceStable(sortedNodePools, func(i, j int) bool {
+		if sortedNodePools[i].Priority != sortedNodePools[j].Priority {
+			return sortedNodePools[i].Priority < sortedNodePools[j].Priority
+		}
+		return sortedNodePools[i].Name < sortedNodePools[j].Name
+	})
+
+	conf := *c
+	conf.Pools = make([]PoolConfig, 0, len(c.Pools)+len(sortedNodePools))
+	conf.Pools = append(conf.Pools, c.Pools...)
+	for _, nodePool := range sortedNodePools {
+		conf.Pools = append(conf.Pools, nodePool.PoolConfig)
+	}
+
+	return &conf
+}
@@ -23,14 +23,36 @@ type (
 
 		K8s struct {
 			NodeLabelSelector     string        `long:"kube.node.labelselector"     env:"KUBE_NODE_LABELSELECTOR"     description:"Node Label selector which nodes should be checked"        default:""`
-			WatchTimeout          time.Duration `long:"kube.watch.timeout"          env:"KUBE_WATCH_TIMEOUT"          description:"Timeout & full resync for node watch (time.Duration)"     default:"24h"`
-			ReapplyOnWatchTimeout bool          `long:"kube.watch.reapply"          env:"KUBE_WATCH_REAPPLY"          description:"Reapply node settings on watch timeout"`
+			WatchTimeout          time.Duration `long:"kube.watch.timeout"          env:"KUBE_WATCH_TIMEOUT"          description:"Interval of full resync for node watch (time.Duration)"   default:"24h"`
+			ReapplyOnWatchTimeout bool          `long:"kube.watch.reapply"          env:"KUBE_WATCH_REAPPLY"          description:"Reapply node settings on full resync"`
+			Workers               int           `long:"kube.workers"                env:"KUBE_WORKERS"                description:"Number of parallel node workers"                          default:"5"`
+		}
+
+		// startup taint
+		StartupTaint struct {
+			Enabled bool   `long:"startuptaint"        env:"STARTUP_TAINT"        description:"Apply pool configuration as soon as nodes are registered (without waiting for kubelet ready unless a global readinessGate is configured) and remove the startup taint afterwards"`
+			Taint   string `long:"startuptaint.taint"  env:"STARTUP_TAINT_TAINT"  description:"Startup taint (key:Effect) registered by the kubelet, removed after the pool configuration was applied successfully"  default:"kube-pool-manager.webdevops.io/unconfigured:NoSchedule"`
+		}
+
+		// events
+		Events struct {
+			Enabled bool `long:"events"  env:"EVENTS"  description:"Create Kubernetes events on nodes (applied pools, failed patches, pools no longer matching)"`
+		}
+
+		// NodePool CRD
+		NodePool struct {
+			Enabled        bool          `long:"nodepool.crd"              env:"NODEPOOL_CRD"              description:"Use NodePool objects (CustomResourceDefinition) as additional pool configuration"`
+			StatusInterval time.Duration `long:"nodepool.status.interval"  env:"NODEPOOL_STATUS_INTERVAL"  description:"Interval for updating the status of NodePool objects"  default:"30s"`
 		}
 
 		// lease
 		Lease struct {
 			Enabled bool   `long:"lease.enable"  env:"LEASE_ENABLE"  description:"Enable lease (leader election; enabled by default in docker images)"`
 			Name    string `long:"lease.name"    env:"LEASE_NAME"    description:"Name of lease lock"     default:"kube-pool-manager-leader"`
+
+			LeaseDuration time.Duration `long:"lease.duration"        env:"LEASE_DURATION"        description:"Duration non-leaders wait before trying to acquire the lease"  default:"15s"`
+			RenewDeadline time.Duration `long:"lease.renew.deadline"  env:"LEASE_RENEW_DEADLINE"  description:"Duration the leader retries renewing the lease before giving up"  default:"10s"`
+			RetryPeriod   time.Duration `long:"lease.retry.period"    env:"LEASE_RETRY_PERIOD"    description:"Interval between lease acquire and renew attempts"  default:"2s"`
 		}
 
 		// server
@@ -41,9 +63,27 @@ type (
 			WriteTimeout time.Duration `long:"server.timeout.write"     env:"SERVER_TIMEOUT_WRITE"  description:"Server write timeout"  default:"10s"`
 		}
 
+		// health
+		Health struct {
+			LivenessTimeout time.Duration `long:"health.liveness.timeout"  env:"HEALTH_LIVENESS_TIMEOUT"  description:"Liveness probe fails if nodes are pending and the reconcile loop made no progress within this time (0 to disable)"  default:"10m"`
+		}
+
+		// config
+		ConfigWatch struct {
+			Enabled  bool          `long:"config.watch"             env:"CONFIG_WATCH"           description:"Watch config file for changes and reload configuration"`
+			Interval time.Duration `long:"config.watch.interval"    env:"CONFIG_WATCH_INTERVAL"  description:"Interval for checking config file for changes"  default:"30s"`
+		}
+
+		// shutdown
+		Shutdown struct {
+			Timeout       time.Duration `long:"shutdown.timeout"         env:"SHUTDOWN_TIMEOUT"         description:"Grace period for finishing in-flight node patches on shutdown"  default:"20s"`
+			ServerTimeout time.Duration `long:"shutdown.server.timeout"  env:"SHUTDOWN_SERVER_TIMEOUT"  description:"Grace period for finishing http requests on shutdown (after node patches are finished)"  default:"5s"`
+		}
+
 		// general options
-		DryRun bool   `long:"dry-run"  env:"DRY_RUN"       description:"Dry run (do not apply to nodes)"`
-		Config string `long:"config"   env:"CONFIG"        description:"Config path"        required:"true"`
+		DryRun       bool   `long:"dry-run"         env:"DRY_RUN"        description:"Dry run (do not apply to nodes)"`
+		Config       string `long:"config"          env:"CONFIG"         description:"Config path (optional if NodePool CRD is enabled)"`
+		ConfigStrict bool   `long:"config.strict"   env:"CONFIG_STRICT"  description:"Strict config validation (also fail on unknown fields, report errors with file and line)"`
 	}
 )
 
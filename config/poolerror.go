@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// PoolError is the error of a broken pool (eg. selector or template failing for the node)
+	PoolError struct {
+		Pool string
+		Err  error
+	}
+
+	// PoolErrors contains the errors of all broken pools, broken pools are skipped while all other pools are still
+	// applied, so functions returning PoolErrors also return a valid result
+	PoolErrors []*PoolError
+)
+
+func (e *PoolError) Error() string {
+	return fmt.Sprintf(`pool "%v": %v`, e.Pool, e.Err)
+}
+
+func (e *PoolError) Unwrap() error {
+	return e.Err
+}
+
+func (e PoolErrors) Error() string {
+	messages := make([]string, len(e))
+	for num, poolError := range e {
+		messages[num] = poolError.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Pools returns the names of all broken pools
+func (e PoolErrors) Pools() []string {
+	ret := make([]string, len(e))
+	for num, poolError := range e {
+		ret[num] = poolError.Pool
+	}
+	return ret
+}
+
+// errOrNil returns nil if there are no pool errors (avoids non-nil error interfaces with empty lists)
+func (e PoolErrors) errOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// AsPoolErrors returns the pool errors if err only contains errors of broken pools
+func AsPoolErrors(err error) (PoolErrors, bool) {
+	var poolErrors PoolErrors
+	if errors.As(err, &poolErrors) {
+		return poolErrors, true
+	}
+	return nil, false
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+const (
+	SelectorGroupProviderID = "providerID"
+)
+
+type (
+	// PoolConfigSelectorProviderID matches the fields of the parsed node spec.providerID against glob patterns
+	PoolConfigSelectorProviderID struct {
+		Provider      string `yaml:"provider"`
+		Subscription  string `yaml:"subscription"`
+		ResourceGroup string `yaml:"resourceGroup"`
+		ScaleSet      string `yaml:"scaleSet"`
+		Zone          string `yaml:"zone"`
+		InstanceID    string `yaml:"instanceID"`
+		Project       string `yaml:"project"`
+		Instance      string `yaml:"instance"`
+	}
+
+	providerIDPattern struct {
+		name    string
+		pattern string
+		value   string
+	}
+)
+
+// patterns returns the configured glob patterns with the values of the parsed providerID
+func (selector *PoolConfigSelectorProviderID) patterns(providerID *k8s.ProviderID) []providerIDPattern {
+	if providerID == nil {
+		providerID = &k8s.ProviderID{}
+	}
+
+	patterns := []providerIDPattern{}
+	for _, pattern := range []providerIDPattern{
+		{"provider", selector.Provider, providerID.Provider},
+		{"subscription", selector.Subscription, providerID.Subscription},
+		{"resourceGroup", selector.ResourceGroup, providerID.ResourceGroup},
+		{"scaleSet", selector.ScaleSet, providerID.ScaleSet},
+		{"zone", selector.Zone, providerID.Zone},
+		{"instanceID", selector.InstanceID, providerID.InstanceID},
+		{"project", selector.Project, providerID.Project},
+		{"instance", selector.Instance, providerID.Instance},
+	} {
+		if pattern.pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// String returns the configured patterns (eg. "provider=azure,scaleSet=aks-agents-*")
+func (selector *PoolConfigSelectorProviderID) String() string {
+	parts := []string{}
+	for _, pattern := range selector.patterns(nil) {
+		parts = append(parts, fmt.Sprintf("%s=%s", pattern.name, pattern.pattern))
+	}
+	return strings.Join(parts, ",")
+}
+
+// compile checks the glob patterns
+func (selector *PoolConfigSelectorProviderID) compile() error {
+	patterns := selector.patterns(nil)
+	if len(patterns) == 0 {
+		return fmt.Errorf("providerID selector has no field defined")
+	}
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern.pattern, ""); err != nil {
+			return fmt.Errorf(`providerID field %v: invalid pattern "%v": %w`, pattern.name, pattern.pattern, err)
+		}
+	}
+	return nil
+}
+
+// evaluate matches the glob patterns against the parsed providerID of the node
+func (selector *PoolConfigSelectorProviderID) evaluate(node *corev1.Node) (*SelectorResult, error) {
+	result := &SelectorResult{
+		Group:    SelectorGroupProviderID,
+		Selector: selector.String(),
+	}
+
+	if err := selector.compile(); err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range selector.patterns(k8s.ParseProviderID(node.Spec.ProviderID)) {
+		// patterns are checked by compile
+		if matching, _ := path.Match(pattern.pattern, pattern.value); !matching {
+			result.Message = fmt.Sprintf("%s \"%s\" is not matching \"%s\"", pattern.name, pattern.value, pattern.pattern)
+			return result, nil
+		}
+	}
+
+	result.Matching = true
+	result.Message = "providerID fields are matching"
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// DefaultReadinessGate waits for the kubelet to be ready
+	DefaultReadinessGate = ReadinessGate{
+		Conditions: []ReadinessGateCondition{
+			{Type: string(corev1.NodeReady), Status: string(corev1.ConditionTrue), Reason: "KubeletReady"},
+		},
+	}
+)
+
+type (
+	// ReadinessGate defines when the configuration of a pool is applied to a node
+	ReadinessGate struct {
+		// Immediate applies the configuration as soon as the node is registered
+		Immediate bool `yaml:"immediate" json:"immediate,omitempty"`
+
+		// Conditions which all have to be fulfilled by the node
+		Conditions []ReadinessGateCondition `yaml:"conditions" json:"conditions,omitempty"`
+	}
+
+	ReadinessGateCondition struct {
+		Type   string `yaml:"type" json:"type"`
+		Status string `yaml:"status" json:"status,omitempty" enum:"True,False,Unknown"`
+		Reason string `yaml:"reason" json:"reason,omitempty"`
+	}
+)
+
+// GetReadinessGate returns the global readiness gate (defaults to DefaultReadinessGate)
+func (c *Config) GetReadinessGate() *ReadinessGate {
+	if c.ReadinessGate != nil {
+		return c.ReadinessGate
+	}
+	return &DefaultReadinessGate
+}
+
+// WithStartupTaint returns a copy of the configuration for the startup taint mode, nodes are protected by the
+// startup taint so pools are applied immediately unless a global readiness gate is configured
+func (c *Config) WithStartupTaint() *Config {
+	conf := *c
+	if conf.ReadinessGate == nil {
+		conf.ReadinessGate = &ReadinessGate{Immediate: true}
+	}
+	return &conf
+}
+
+// GetReadinessGate returns the readiness gate of the pool, falls back to the global readiness gate
+func (p *PoolConfig) GetReadinessGate(global *ReadinessGate) *ReadinessGate {
+	if p.ReadinessGate != nil {
+		return p.ReadinessGate
+	}
+	return global
+}
+
+// IsOpen checks if the node fulfills the readiness gate, returns the reason if not
+func (gate *ReadinessGate) IsOpen(node *corev1.Node) (bool, string) {
+	if gate.Immediate {
+		return true, "immediate"
+	}
+
+	for _, requirement := range gate.Conditions {
+		if !requirement.isFulfilled(node) {
+			return false, fmt.Sprintf("waiting for condition %s", requirement.String())
+		}
+	}
+
+	return true, "all conditions are fulfilled"
+}
+
+// isFulfilled checks if the node has the condition with status (and reason if set), type and status are compared case insensitive
+func (requirement *ReadinessGateCondition) isFulfilled(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if !strings.EqualFold(string(condition.Type), requirement.Type) {
+			continue
+		}
+
+		if requirement.Status != "" && !strings.EqualFold(string(condition.Status), requirement.Status) {
+			return false
+		}
+
+		if requirement.Reason != "" && !strings.EqualFold(condition.Reason, requirement.Reason) {
+			return false
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// String returns the condition in format "Type=Status (Reason)"
+func (requirement *ReadinessGateCondition) String() string {
+	ret := requirement.Type
+	if requirement.Status != "" {
+		ret = fmt.Sprintf("%s=%s", ret, requirement.Status)
+	}
+	if requirement.Reason != "" {
+		ret = fmt.Sprintf("%s (%s)", ret, requirement.Reason)
+	}
+	return ret
+}
+
+// MatchingPoolsByReadiness returns the matching pools of the node split by their readiness gate
+// (broken pools are returned as PoolErrors, see MatchingPools)
+func (c *Config) MatchingPoolsByReadiness(logger *zap.SugaredLogger, node *corev1.Node) (readyPools, gatedPools []*PoolConfig, err error) {
+	pools, err := c.MatchingPools(logger, node)
+	if _, ok := AsPoolErrors(err); err != nil && !ok {
+		return nil, nil, err
+	}
+
+	readyPools, gatedPools = c.splitPoolsByReadiness(logger, node, pools)
+	return readyPools, gatedPools, err
+}
+
+// splitPoolsByReadiness splits the pools by their readiness gate
+func (c *Config) splitPoolsByReadiness(logger *zap.SugaredLogger, node *corev1.Node, pools []*PoolConfig) (readyPools, gatedPools []*PoolConfig) {
+	readyPools = []*PoolConfig{}
+	gatedPools = []*PoolConfig{}
+	for _, poolConfig := range pools {
+		if open, reason := poolConfig.GetReadinessGate(c.GetReadinessGate()).IsOpen(node); !open {
+			logger.With(zap.String("pool", poolConfig.Name)).Debugf("pool \"%s\" is not applied to node \"%s\" yet: %s", poolConfig.Name, node.Name, reason)
+			gatedPools = append(gatedPools, poolConfig)
+			continue
+		}
+		readyPools = append(readyPools, poolConfig)
+	}
+
+	return readyPools, gatedPools
+}
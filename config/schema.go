@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const (
+	JsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+)
+
+type (
+	// jsonSchemaProvider is implemented by types with custom yaml parsing
+	jsonSchemaProvider interface {
+		JSONSchema() map[string]interface{}
+	}
+
+	jsonSchemaGenerator struct {
+		definitions map[string]interface{}
+	}
+)
+
+var (
+	jsonSchemaProviderType = reflect.TypeOf((*jsonSchemaProvider)(nil)).Elem()
+
+	// configValueSchema is the schema of values in value maps, yaml scalars are parsed as string, null removes the key
+	configValueSchema = map[string]interface{}{
+		"type": []string{"string", "number", "boolean", "null"},
+	}
+)
+
+// JsonSchema generates the json schema of the configuration file
+func JsonSchema() ([]byte, error) {
+	generator := jsonSchemaGenerator{
+		definitions: map[string]interface{}{},
+	}
+
+	schema := generator.structSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = JsonSchemaDraft
+	schema["title"] = "kube-pool-manager configuration"
+	schema["$defs"] = generator.definitions
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func (g *jsonSchemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Implements(jsonSchemaProviderType) {
+		return reflect.Zero(t).Interface().(jsonSchemaProvider).JSONSchema()
+	} else if reflect.PointerTo(t).Implements(jsonSchemaProviderType) {
+		return reflect.New(t).Interface().(jsonSchemaProvider).JSONSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+
+		// named structs are stored as definition
+		if _, exists := g.definitions[t.Name()]; !exists {
+			g.definitions[t.Name()] = map[string]interface{}{}
+			g.definitions[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": g.typeSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.typeSchema(t.Elem()),
+		}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		// any value
+		return map[string]interface{}{}
+	}
+}
+
+func (g *jsonSchemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	g.structProperties(t, properties)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func (g *jsonSchemaGenerator) structProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+
+		if len(tag) > 1 && tag[1] == "inline" {
+			g.structProperties(field.Type, properties)
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		schema := g.typeSchema(field.Type)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+	}
+}
+
+// JSONSchema returns the json schema of the value map (map of values or list of keys)
+func (valueMap *PoolConfigNodeValueMap) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": configValueSchema,
+			},
+			map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+	}
+}
+
+// JSONSchema returns the json schema of the taint map (map of "key:Effect" or list in kubectl format)
+func (taintMap *PoolConfigNodeTaintMap) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{
+				"type": "object",
+				"propertyNames": map[string]interface{}{
+					"pattern": "^[^:=]+:(NoSchedule|PreferNoSchedule|NoExecute)$",
+				},
+				"additionalProperties": configValueSchema,
+			},
+			map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":    "string",
+					"pattern": "^[^:=]+(=[^:]*)?:(NoSchedule|PreferNoSchedule|NoExecute)$",
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,554 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	SelectorGroupAllOf  = "allOf"
+	SelectorGroupAnyOf  = "anyOf"
+	SelectorGroupNoneOf = "noneOf"
+
+	SelectorGroupLabelSelector = "labelSelector"
+	SelectorGroupFieldSelector = "fieldSelector"
+
+	// SelectorTypeInt compares values as integers (default)
+	SelectorTypeInt = "int"
+
+	// SelectorTypeQuantity compares values as kubernetes resource quantities (eg. 64Gi, 500m)
+	SelectorTypeQuantity = "quantity"
+
+	// SelectorTypeSemver compares values as semantic versions (eg. v1.30.0)
+	SelectorTypeSemver = "semver"
+)
+
+type (
+	// SelectorResult is the result of a selector evaluation against a node
+	SelectorResult struct {
+		Path     string            `json:"path,omitempty"`
+		Group    string            `json:"group,omitempty"`
+		Selector string            `json:"selector,omitempty"`
+		Value    *string           `json:"value,omitempty"`
+		Matching bool              `json:"matching"`
+		Message  string            `json:"message"`
+		Captures map[string]string `json:"captures,omitempty"`
+		Children []*SelectorResult `json:"children,omitempty"`
+	}
+)
+
+// Description returns the path or the group of the selector
+func (result *SelectorResult) Description() string {
+	if result.Path != "" {
+		return fmt.Sprintf("path \"%s\"", result.Path)
+	}
+	if result.Selector != "" {
+		return fmt.Sprintf("%s \"%s\"", result.Group, result.Selector)
+	}
+	return fmt.Sprintf("selector %s", result.Group)
+}
+
+// compile parses regexp and path of the selector, the selector must not be changed afterwards
+// (compiled selectors are evaluated concurrently)
+func (selector *PoolConfigSelector) compile(name string) error {
+	compiledRegexp, err := selector.compileRegexp()
+	if err != nil {
+		return err
+	}
+	selector.regexp = compiledRegexp
+
+	if selector.Path != "" {
+		jsonPath, err := selector.newJsonPath(name)
+		if err != nil {
+			return fmt.Errorf(`selector "%v": %w`, selector.Path, err)
+		}
+		selector.jsonPath = &compiledJsonPath{jsonPath: jsonPath}
+	}
+
+	for _, comparison := range selector.comparisons() {
+		if _, err := parseSelectorValue(selector.GetType(), *comparison.value); err != nil {
+			return fmt.Errorf(`selector "%v": %v: %w`, selector.Path, comparison.name, err)
+		}
+	}
+
+	if selector.ProviderID != nil {
+		if err := selector.ProviderID.compile(); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range selector.groups() {
+		for num := range group.selectors {
+			if err := group.selectors[num].compile(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileRegexp returns the compiled regexp of the selector (nil if not set)
+func (selector *PoolConfigSelector) compileRegexp() (*regexp.Regexp, error) {
+	if selector.regexp != nil || selector.Regexp == nil {
+		return selector.regexp, nil
+	}
+
+	compiledRegexp, err := regexp.Compile(*selector.Regexp)
+	if err != nil {
+		return nil, fmt.Errorf(`selector "%v": %w`, selector.Path, err)
+	}
+	return compiledRegexp, nil
+}
+
+// newJsonPath parses the selector path
+func (selector *PoolConfigSelector) newJsonPath(name string) (*jsonpath.JSONPath, error) {
+	jsonPath := jsonpath.New(name)
+	jsonPath.AllowMissingKeys(true)
+	if err := jsonPath.Parse(selector.Path); err != nil {
+		return nil, err
+	}
+	return jsonPath, nil
+}
+
+// findResults evaluates the selector path against the node
+func (selector *PoolConfigSelector) findResults(name string, node *corev1.Node) ([][]reflect.Value, error) {
+	// selectors which were not compiled (eg. created in code) are parsed for each evaluation
+	if selector.jsonPath == nil {
+		jsonPath, err := selector.newJsonPath(name)
+		if err != nil {
+			return nil, fmt.Errorf(`selector "%v": %w`, selector.Path, err)
+		}
+		return jsonPath.FindResults(node)
+	}
+
+	// JSONPath keeps state while evaluating and is not safe for concurrent use
+	selector.jsonPath.lock.Lock()
+	defer selector.jsonPath.lock.Unlock()
+	return selector.jsonPath.jsonPath.FindResults(node)
+}
+
+// compiledJsonPath is the parsed path of a compiled selector
+type compiledJsonPath struct {
+	lock     sync.Mutex
+	jsonPath *jsonpath.JSONPath
+}
+
+type selectorGroup struct {
+	name      string
+	selectors []PoolConfigSelector
+}
+
+// groups returns the nested selector groups (allOf, anyOf, noneOf) which are set
+func (selector *PoolConfigSelector) groups() []selectorGroup {
+	groups := []selectorGroup{}
+	if selector.AllOf != nil {
+		groups = append(groups, selectorGroup{name: SelectorGroupAllOf, selectors: selector.AllOf})
+	}
+	if selector.AnyOf != nil {
+		groups = append(groups, selectorGroup{name: SelectorGroupAnyOf, selectors: selector.AnyOf})
+	}
+	if selector.NoneOf != nil {
+		groups = append(groups, selectorGroup{name: SelectorGroupNoneOf, selectors: selector.NoneOf})
+	}
+	return groups
+}
+
+// Evaluate evaluates the selector (and nested selector groups) against the node, evaluation stops as soon as the result is known
+// all operators of a selector have to match, match and regexp are combined (either of them has to match)
+func (selector *PoolConfigSelector) Evaluate(name string, node *corev1.Node) (*SelectorResult, error) {
+	return selector.evaluate(name, node, true)
+}
+
+func (selector *PoolConfigSelector) evaluate(name string, node *corev1.Node, shortCircuit bool) (*SelectorResult, error) {
+	result := &SelectorResult{
+		Path:     selector.Path,
+		Matching: true,
+	}
+
+	groups := selector.groups()
+	messages := []string{}
+
+	if selector.Path != "" {
+		pathResult, err := selector.evaluatePath(name, node)
+		if err != nil {
+			return nil, err
+		}
+		result.Value = pathResult.Value
+		result.Captures = pathResult.Captures
+		result.Matching = pathResult.Matching
+		messages = append(messages, pathResult.Message)
+	}
+
+	if selector.ProviderID != nil {
+		providerIDResult, err := selector.ProviderID.evaluate(node)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Path == "" {
+			result.Group = providerIDResult.Group
+			result.Selector = providerIDResult.Selector
+		}
+		if !providerIDResult.Matching {
+			result.Matching = false
+		}
+		messages = append(messages, providerIDResult.Message)
+	}
+
+	if selector.Path == "" && selector.ProviderID == nil && len(groups) == 0 {
+		result.Matching = false
+		messages = append(messages, "has neither path, providerID nor selector group defined")
+	}
+
+	for _, group := range groups {
+		if shortCircuit && !result.Matching {
+			break
+		}
+
+		groupResult, err := evaluateSelectorGroup(name, node, group, shortCircuit)
+		if err != nil {
+			return nil, err
+		}
+		result.Children = append(result.Children, groupResult)
+
+		if !groupResult.Matching {
+			result.Matching = false
+		}
+		messages = append(messages, groupResult.Message)
+	}
+	result.Message = strings.Join(messages, ", ")
+
+	// selector consists only of one group, no need for another level
+	if selector.Path == "" && selector.ProviderID == nil && len(result.Children) == 1 {
+		result = result.Children[0]
+	}
+
+	if selector.Not {
+		result.Matching = !result.Matching
+		result.Message = fmt.Sprintf("negated: %s", result.Message)
+	}
+
+	return result, nil
+}
+
+// evaluateSelectorGroup evaluates the selectors of an allOf, anyOf or noneOf group, the message contains the deciding branch
+func evaluateSelectorGroup(name string, node *corev1.Node, group selectorGroup, shortCircuit bool) (*SelectorResult, error) {
+	result := &SelectorResult{
+		Group:    group.name,
+		Children: []*SelectorResult{},
+	}
+
+	// result if no branch decides the group
+	result.Matching = group.name != SelectorGroupAnyOf
+	result.Message = fmt.Sprintf("%s: no branch matching", group.name)
+	if group.name == SelectorGroupAllOf {
+		result.Message = fmt.Sprintf("%s: all %d branches matching", group.name, len(group.selectors))
+	}
+
+	decided := false
+	for num := range group.selectors {
+		childResult, err := group.selectors[num].evaluate(name, node, shortCircuit)
+		if err != nil {
+			return nil, err
+		}
+		result.Children = append(result.Children, childResult)
+
+		if decided {
+			continue
+		}
+
+		switch {
+		case group.name == SelectorGroupAllOf && !childResult.Matching:
+			result.Matching = false
+			result.Message = fmt.Sprintf("%s: branch [%d] not matching (%s %s)", group.name, num, childResult.Description(), childResult.Message)
+			decided = true
+		case group.name == SelectorGroupAnyOf && childResult.Matching:
+			result.Matching = true
+			result.Message = fmt.Sprintf("%s: branch [%d] matching (%s %s)", group.name, num, childResult.Description(), childResult.Message)
+			decided = true
+		case group.name == SelectorGroupNoneOf && childResult.Matching:
+			result.Matching = false
+			result.Message = fmt.Sprintf("%s: branch [%d] matching (%s %s)", group.name, num, childResult.Description(), childResult.Message)
+			decided = true
+		}
+
+		if decided && shortCircuit {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// evaluatePath evaluates the operators of the selector against the value of the path
+func (selector *PoolConfigSelector) evaluatePath(name string, node *corev1.Node) (*SelectorResult, error) {
+	result := &SelectorResult{
+		Path: selector.Path,
+	}
+
+	compiledRegexp, err := selector.compileRegexp()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := selector.findResults(name, node)
+	if err != nil {
+		return nil, err
+	}
+
+	valueDescription := "not found"
+	if len(values) == 1 && len(values[0]) == 1 {
+		if val, ok := formatSelectorValue(values[0][0]); ok {
+			result.Value = &val
+			valueDescription = fmt.Sprintf("with value \"%s\"", val)
+		}
+	}
+
+	// named capture groups of the regexp (used by templates)
+	if result.Value != nil && compiledRegexp != nil {
+		if match := compiledRegexp.FindStringSubmatch(*result.Value); match != nil {
+			for num, groupName := range compiledRegexp.SubexpNames() {
+				if groupName != "" {
+					if result.Captures == nil {
+						result.Captures = map[string]string{}
+					}
+					result.Captures[groupName] = match[num]
+				}
+			}
+		}
+	}
+
+	checks := selector.checks(result.Value, compiledRegexp)
+	if len(checks) == 0 {
+		result.Message = fmt.Sprintf("%s has no operator defined", valueDescription)
+		return result, nil
+	}
+
+	result.Matching = true
+	messages := []string{}
+	for _, check := range checks {
+		if !check.matching {
+			result.Matching = false
+		}
+
+		if check.matching {
+			messages = append(messages, fmt.Sprintf("%s is %s", valueDescription, check.description))
+		} else {
+			messages = append(messages, fmt.Sprintf("%s is not %s", valueDescription, check.description))
+		}
+	}
+	result.Message = strings.Join(messages, ", ")
+
+	return result, nil
+}
+
+// formatSelectorValue converts the JSONPath result to a string, quantities and other stringers are formatted by String(),
+// lists and objects as json. Returns false for nil values
+func formatSelectorValue(value reflect.Value) (string, bool) {
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return "", false
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.String {
+		return value.String(), true
+	}
+
+	if !value.CanInterface() {
+		return value.String(), true
+	}
+
+	// eg. resource.Quantity implements String() on the pointer
+	pointer := reflect.New(value.Type())
+	pointer.Elem().Set(value)
+	if stringer, ok := pointer.Interface().(fmt.Stringer); ok {
+		return stringer.String(), true
+	}
+
+	switch value.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		data, err := json.Marshal(value.Interface())
+		if err == nil {
+			return string(data), true
+		}
+	}
+
+	return fmt.Sprint(value.Interface()), true
+}
+
+type selectorCheck struct {
+	matching    bool
+	description string
+}
+
+// checks evaluates all operators of the selector against the value (nil if not found)
+func (selector *PoolConfigSelector) checks(val *string, compiledRegexp *regexp.Regexp) []selectorCheck {
+	checks := []selectorCheck{}
+
+	// match and regexp (either of them has to match)
+	if selector.Match != nil || compiledRegexp != nil {
+		check := selectorCheck{}
+		descriptions := []string{}
+
+		if selector.Match != nil {
+			descriptions = append(descriptions, fmt.Sprintf("matching value \"%s\"", *selector.Match))
+			if val != nil && strings.Compare(*val, *selector.Match) == 0 {
+				check.matching = true
+			}
+		}
+
+		if compiledRegexp != nil {
+			descriptions = append(descriptions, fmt.Sprintf("matching regexp \"%s\"", *selector.Regexp))
+			if val != nil && compiledRegexp.MatchString(*val) {
+				check.matching = true
+			}
+		}
+
+		check.description = strings.Join(descriptions, " or ")
+		checks = append(checks, check)
+	}
+
+	// exists
+	if selector.Exists {
+		checks = append(checks, selectorCheck{
+			matching:    val != nil,
+			description: "existing",
+		})
+	}
+
+	// notExists
+	if selector.NotExists {
+		checks = append(checks, selectorCheck{
+			matching:    val == nil,
+			description: "not existing",
+		})
+	}
+
+	// in
+	if selector.In != nil {
+		checks = append(checks, selectorCheck{
+			matching:    val != nil && ContainsKey(selector.In, *val),
+			description: fmt.Sprintf("in [%s]", strings.Join(selector.In, ", ")),
+		})
+	}
+
+	// notIn (also matching if not found, same as kubernetes label selectors)
+	if selector.NotIn != nil {
+		checks = append(checks, selectorCheck{
+			matching:    val == nil || !ContainsKey(selector.NotIn, *val),
+			description: fmt.Sprintf("not in [%s]", strings.Join(selector.NotIn, ", ")),
+		})
+	}
+
+	// gt, gte, lt, lte (not matching if not found or not parsable)
+	for _, comparison := range selector.comparisons() {
+		check := selectorCheck{
+			description: fmt.Sprintf("%s \"%s\" (%s)", comparison.description, *comparison.value, selector.GetType()),
+		}
+
+		if val != nil {
+			result, err := compareSelectorValues(selector.GetType(), *val, *comparison.value)
+			if err != nil {
+				check.description = fmt.Sprintf("%s: %v", check.description, err)
+			} else {
+				check.matching = comparison.matches(result)
+			}
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// GetType returns the type used for comparisons, defaults to int
+func (selector *PoolConfigSelector) GetType() string {
+	if selector.Type == "" {
+		return SelectorTypeInt
+	}
+	return selector.Type
+}
+
+type selectorComparison struct {
+	name        string
+	description string
+	value       *string
+	matches     func(result int) bool
+}
+
+// comparisons returns the comparison operators (gt, gte, lt, lte) which are set
+func (selector *PoolConfigSelector) comparisons() []selectorComparison {
+	comparisons := []selectorComparison{}
+	if selector.Gt != nil {
+		comparisons = append(comparisons, selectorComparison{"gt", "greater than", selector.Gt, func(result int) bool { return result > 0 }})
+	}
+	if selector.Gte != nil {
+		comparisons = append(comparisons, selectorComparison{"gte", "greater than or equal", selector.Gte, func(result int) bool { return result >= 0 }})
+	}
+	if selector.Lt != nil {
+		comparisons = append(comparisons, selectorComparison{"lt", "less than", selector.Lt, func(result int) bool { return result < 0 }})
+	}
+	if selector.Lte != nil {
+		comparisons = append(comparisons, selectorComparison{"lte", "less than or equal", selector.Lte, func(result int) bool { return result <= 0 }})
+	}
+	return comparisons
+}
+
+// parseSelectorValue parses the value as type int, quantity or semver, semver values only keep major.minor.patch
+// (provider suffixes like "-eks-a737599" or "-gke.1200" are not pre-releases)
+func parseSelectorValue(valueType, value string) (interface{}, error) {
+	switch valueType {
+	case SelectorTypeInt:
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case SelectorTypeQuantity:
+		return resource.ParseQuantity(strings.TrimSpace(value))
+	case SelectorTypeSemver:
+		return version.ParseGeneric(strings.TrimSpace(value))
+	default:
+		return nil, fmt.Errorf(`invalid type "%v", expected one of %v, %v or %v`, valueType, SelectorTypeInt, SelectorTypeQuantity, SelectorTypeSemver)
+	}
+}
+
+// compareSelectorValues compares both values as type and returns -1, 0 or 1
+func compareSelectorValues(valueType, a, b string) (int, error) {
+	parsedA, err := parseSelectorValue(valueType, a)
+	if err != nil {
+		return 0, err
+	}
+
+	parsedB, err := parseSelectorValue(valueType, b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := parsedA.(type) {
+	case int64:
+		return cmp.Compare(v, parsedB.(int64)), nil
+	case resource.Quantity:
+		return v.Cmp(parsedB.(resource.Quantity)), nil
+	case *version.Version:
+		switch other := parsedB.(*version.Version); {
+		case v.LessThan(other):
+			return -1, nil
+		case v.GreaterThan(other):
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	}
+
+	return 0, fmt.Errorf(`invalid type "%v"`, valueType)
+}
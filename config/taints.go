@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+type (
+	PoolConfigNodeTaintMap struct {
+		entries *map[string]*string
+	}
+)
+
+// Entries returns the taint map, keys are in format "key:Effect", nil values mark taints for removal
+func (taintMap *PoolConfigNodeTaintMap) Entries() map[string]*string {
+	var mapList map[string]*string
+
+	if taintMap.entries != nil {
+		mapList = *taintMap.entries
+	}
+
+	return mapList
+}
+
+func (taintMap PoolConfigNodeTaintMap) MarshalYAML() (interface{}, error) {
+	return taintMap.Entries(), nil
+}
+
+func (taintMap *PoolConfigNodeTaintMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	mapList := map[string]*string{}
+	err := unmarshal(&mapList)
+	if err != nil {
+		// list in kubectl taint format: key[=value]:Effect
+		var stringList []string
+		err := unmarshal(&stringList)
+		if err != nil {
+			return err
+		}
+		for _, val := range stringList {
+			taintKey, taintEffect, found := strings.Cut(val, ":")
+			if !found {
+				return fmt.Errorf(`taint "%v" is missing effect, expected format "key[=value]:Effect"`, val)
+			}
+
+			key, value, _ := strings.Cut(taintKey, "=")
+			mapList[fmt.Sprintf("%s:%s", key, taintEffect)] = &value
+		}
+	}
+
+	for taint := range mapList {
+		if _, _, err := parseTaintKey(taint); err != nil {
+			return err
+		}
+	}
+
+	if len(mapList) > 0 {
+		taintMap.entries = &mapList
+	}
+
+	return nil
+}
+
+// Apply merges the configured taints into the list of existing taints
+// taints are identified by key and effect, existing taints which are not configured are kept
+func (taintMap *PoolConfigNodeTaintMap) Apply(taints []corev1.Taint) ([]corev1.Taint, bool) {
+	entries := taintMap.Entries()
+
+	ret := make([]corev1.Taint, len(taints))
+	copy(ret, taints)
+
+	// ensure stable order of appended taints
+	taintList := make([]string, 0, len(entries))
+	for taint := range entries {
+		taintList = append(taintList, taint)
+	}
+	sort.Strings(taintList)
+
+	changed := false
+	for _, taint := range taintList {
+		taintValue := entries[taint]
+		key, effect, err := parseTaintKey(taint)
+		if err != nil {
+			// already validated while parsing
+			continue
+		}
+
+		existingIndex := -1
+		for num, existingTaint := range ret {
+			if existingTaint.Key == key && existingTaint.Effect == effect {
+				existingIndex = num
+				break
+			}
+		}
+
+		switch {
+		case taintValue == nil && existingIndex >= 0:
+			// remove taint
+			ret = append(ret[:existingIndex], ret[existingIndex+1:]...)
+			changed = true
+		case taintValue == nil:
+			// taint not existing, nothing to remove
+		case existingIndex >= 0:
+			// update taint
+			if ret[existingIndex].Value != *taintValue {
+				ret[existingIndex].Value = *taintValue
+				changed = true
+			}
+		default:
+			// add taint
+			ret = append(ret, corev1.Taint{
+				Key:    key,
+				Value:  *taintValue,
+				Effect: effect,
+			})
+			changed = true
+		}
+	}
+
+	return ret, changed
+}
+
+// ValidateTaint checks if the taint is in format "key:Effect"
+func ValidateTaint(taint string) error {
+	_, _, err := parseTaintKey(taint)
+	return err
+}
+
+// NodeHasTaint checks if the node has the taint (format "key:Effect")
+func NodeHasTaint(node *corev1.Node, taint string) (bool, error) {
+	key, effect, err := parseTaintKey(taint)
+	if err != nil {
+		return false, err
+	}
+
+	for _, nodeTaint := range node.Spec.Taints {
+		if nodeTaint.Key == key && nodeTaint.Effect == effect {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addTaintsPrecondition adds a precondition to the patch set if the taints are patched, the taint list is always
+// written as a whole (based on the cached node), so concurrent changes (eg. node lifecycle controller, cluster-autoscaler)
+// let the patch fail and the node is retried instead of overwriting them
+func addTaintsPrecondition(patchSet *k8s.JsonPatchSet, node *corev1.Node) {
+	if _, exists := patchSet.List["/spec/taints"]; !exists {
+		return
+	}
+
+	if len(node.Spec.Taints) > 0 {
+		patchSet.AddTest(k8s.JsonPatchObject{
+			Op:    "test",
+			Path:  "/spec/taints",
+			Value: node.Spec.Taints,
+		})
+		return
+	}
+
+	// absence of taints can't be tested, use the resourceVersion instead
+	patchSet.AddTest(k8s.JsonPatchObject{
+		Op:    "test",
+		Path:  "/metadata/resourceVersion",
+		Value: node.ResourceVersion,
+	})
+}
+
+// AddTaintRemovalPatch adds a patch to the patch set which removes the taint (format "key:Effect") from the node,
+// taints already patched by the pools are kept
+func AddTaintRemovalPatch(patchSet *k8s.JsonPatchSet, node *corev1.Node, taint string) error {
+	if err := ValidateTaint(taint); err != nil {
+		return err
+	}
+
+	taints := node.Spec.Taints
+	if patch, exists := patchSet.List["/spec/taints"]; exists {
+		if patchObject, ok := patch.(k8s.JsonPatchObject); ok {
+			if patchTaints, ok := patchObject.Value.([]corev1.Taint); ok {
+				taints = patchTaints
+			}
+		}
+	}
+
+	removal := PoolConfigNodeTaintMap{entries: &map[string]*string{taint: nil}}
+	if taints, changed := removal.Apply(taints); changed {
+		patchSet.Add(k8s.JsonPatchObject{
+			Op:    "add",
+			Path:  "/spec/taints",
+			Value: taints,
+		})
+	}
+	addTaintsPrecondition(patchSet, node)
+
+	return nil
+}
+
+// parseTaintKey parses taint keys in format "key:Effect"
+func parseTaintKey(val string) (string, corev1.TaintEffect, error) {
+	key, effect, found := strings.Cut(val, ":")
+	if !found || key == "" {
+		return "", "", fmt.Errorf(`invalid taint "%v", expected format "key:Effect"`, val)
+	}
+
+	switch taintEffect := corev1.TaintEffect(effect); taintEffect {
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		return key, taintEffect, nil
+	default:
+		return "", "", fmt.Errorf(`invalid taint effect "%v" for taint "%v", expected one of %v, %v or %v`, effect, key, corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+	}
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+var (
+	labelValueInvalidCharsRegexp = regexp.MustCompile(`[^-A-Za-z0-9_.]+`)
+	labelValueTrimRegexp         = regexp.MustCompile(`^[^A-Za-z0-9]+|[^A-Za-z0-9]+$`)
+
+	templateFuncs = template.FuncMap{
+		"label":      SanitizeLabelValue,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"replace":    func(old, new, value string) string { return strings.ReplaceAll(value, old, new) },
+		"trimPrefix": func(prefix, value string) string { return strings.TrimPrefix(value, prefix) },
+		"trimSuffix": func(suffix, value string) string { return strings.TrimSuffix(value, suffix) },
+		"default": func(defaultValue string, value interface{}) string {
+			if str := fmt.Sprint(value); value != nil && str != "" {
+				return str
+			}
+			return defaultValue
+		},
+	}
+)
+
+type (
+	// TemplateData is passed to templated values of a pool
+	TemplateData struct {
+		// Node is the node object
+		Node *corev1.Node
+
+		// ProviderID contains the parsed fields of the node providerID
+		ProviderID *k8s.ProviderID
+
+		// Pool is the name of the pool
+		Pool string
+
+		// Groups are the named capture groups of the regexps of the pool selectors
+		Groups map[string]string
+	}
+)
+
+// isTemplate checks if the value contains a template action
+func isTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// parseTemplate parses the templated value
+func parseTemplate(name, value string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(value)
+}
+
+// SanitizeLabelValue converts the value to a valid label value (invalid characters are replaced by "-",
+// max 63 characters, starting and ending with an alphanumeric character)
+func SanitizeLabelValue(value string) string {
+	value = labelValueInvalidCharsRegexp.ReplaceAllString(value, "-")
+	if len(value) > validation.LabelValueMaxLength {
+		value = value[:validation.LabelValueMaxLength]
+	}
+	return labelValueTrimRegexp.ReplaceAllString(value, "")
+}
+
+// templateData builds the template data for the node, named capture groups are collected from all matching
+// regexps of the pool selectors
+func (p *PoolConfig) templateData(node *corev1.Node) (*TemplateData, error) {
+	data := &TemplateData{
+		Node:       node,
+		ProviderID: k8s.ParseProviderID(node.Spec.ProviderID),
+		Pool:       p.Name,
+		Groups:     map[string]string{},
+	}
+
+	results, err := p.evaluateSelectors(node, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var collectCaptures func(results []*SelectorResult)
+	collectCaptures = func(results []*SelectorResult) {
+		for _, result := range results {
+			for name, value := range result.Captures {
+				data.Groups[name] = value
+			}
+			collectCaptures(result.Children)
+		}
+	}
+	collectCaptures(results)
+
+	return data, nil
+}
+
+// Render returns a copy of the pool with all templated role, label, annotation and json patch values rendered for the node,
+// rendered role and label values are sanitized to valid label values
+func (p *PoolConfig) Render(node *corev1.Node) (*PoolConfig, error) {
+	if !p.hasTemplates() {
+		return p, nil
+	}
+
+	data, err := p.templateData(node)
+	if err != nil {
+		return nil, err
+	}
+
+	renderString := func(name, value string) (string, error) {
+		if !isTemplate(value) {
+			return value, nil
+		}
+
+		tmpl, err := parseTemplate(name, value)
+		if err != nil {
+			return "", err
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	renderValueMap := func(valueMap PoolConfigNodeValueMap, section string, sanitize bool) (PoolConfigNodeValueMap, error) {
+		if valueMap.entries == nil {
+			return valueMap, nil
+		}
+
+		entries := map[string]*string{}
+		for key, value := range valueMap.Entries() {
+			if value != nil {
+				rendered, err := renderString(formatValidationPath([]interface{}{"node", section, key}), *value)
+				if err != nil {
+					return valueMap, fmt.Errorf(`%s "%v": %w`, section, key, err)
+				}
+				if sanitize && isTemplate(*value) {
+					rendered = SanitizeLabelValue(rendered)
+				}
+				value = &rendered
+			}
+			entries[key] = value
+		}
+		return PoolConfigNodeValueMap{entries: &entries}, nil
+	}
+
+	var renderValue func(name string, value interface{}) (interface{}, error)
+	renderValue = func(name string, value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return renderString(name, v)
+		case []interface{}:
+			list := make([]interface{}, len(v))
+			for num, item := range v {
+				rendered, err := renderValue(name, item)
+				if err != nil {
+					return nil, err
+				}
+				list[num] = rendered
+			}
+			return list, nil
+		case map[interface{}]interface{}:
+			obj := make(map[interface{}]interface{}, len(v))
+			for key, item := range v {
+				rendered, err := renderValue(name, item)
+				if err != nil {
+					return nil, err
+				}
+				obj[key] = rendered
+			}
+			return obj, nil
+		case map[string]interface{}:
+			obj := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				rendered, err := renderValue(name, item)
+				if err != nil {
+					return nil, err
+				}
+				obj[key] = rendered
+			}
+			return obj, nil
+		}
+		return value, nil
+	}
+
+	rendered := *p
+	if rendered.Node.Roles, err = renderValueMap(p.Node.Roles, "roles", true); err != nil {
+		return nil, err
+	}
+	if rendered.Node.Labels, err = renderValueMap(p.Node.Labels, "labels", true); err != nil {
+		return nil, err
+	}
+	if rendered.Node.Annotations, err = renderValueMap(p.Node.Annotations, "annotations", false); err != nil {
+		return nil, err
+	}
+
+	rendered.Node.JsonPatches = make([]k8s.JsonPatchObject, len(p.Node.JsonPatches))
+	for num, patch := range p.Node.JsonPatches {
+		if patch.Value, err = renderValue(formatValidationPath([]interface{}{"node", "jsonPatches", num, "value"}), patch.Value); err != nil {
+			return nil, fmt.Errorf(`jsonPatches "%v": %w`, patch.Path, err)
+		}
+		rendered.Node.JsonPatches[num] = patch
+	}
+
+	return &rendered, nil
+}
+
+type poolTemplate struct {
+	path  []interface{}
+	value string
+}
+
+// templates returns all templated values of the pool
+func (p *PoolConfig) templates() []poolTemplate {
+	templates := []poolTemplate{}
+
+	addValueMap := func(valueMap PoolConfigNodeValueMap, section string) {
+		for key, value := range valueMap.Entries() {
+			if value != nil && isTemplate(*value) {
+				templates = append(templates, poolTemplate{[]interface{}{"node", section, key}, *value})
+			}
+		}
+	}
+	addValueMap(p.Node.Roles, "roles")
+	addValueMap(p.Node.Labels, "labels")
+	addValueMap(p.Node.Annotations, "annotations")
+
+	var addValue func(path []interface{}, value interface{})
+	addValue = func(path []interface{}, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if isTemplate(v) {
+				templates = append(templates, poolTemplate{path, v})
+			}
+		case []interface{}:
+			for _, item := range v {
+				addValue(path, item)
+			}
+		case map[interface{}]interface{}:
+			for _, item := range v {
+				addValue(path, item)
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				addValue(path, item)
+			}
+		}
+	}
+	for num, patch := range p.Node.JsonPatches {
+		addValue([]interface{}{"node", "jsonPatches", num, "value"}, patch.Value)
+	}
+
+	return templates
+}
+
+func (p *PoolConfig) hasTemplates() bool {
+	return len(p.templates()) > 0
+}
+
+// compileTemplates checks if all templated values of the pool can be parsed
+func (p *PoolConfig) compileTemplates() error {
+	for _, poolTemplate := range p.templates() {
+		if _, err := parseTemplate(formatValidationPath(poolTemplate.path), poolTemplate.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
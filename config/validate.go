@@ -0,0 +1,450 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+var (
+	yamlErrorLineRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.+)$`)
+)
+
+type (
+	// ValidationError is a configuration error with the location inside the configuration file
+	ValidationError struct {
+		File    string `json:"file,omitempty"`
+		Line    int    `json:"line,omitempty"`
+		Path    string `json:"path,omitempty"`
+		Message string `json:"message"`
+
+		path []interface{}
+
+		// strict errors are only reported with strict validation (--config.strict and the validate command),
+		// configurations with these errors can still be applied
+		strict bool
+	}
+
+	ValidationErrors []*ValidationError
+)
+
+func (e *ValidationError) Error() string {
+	location := []string{}
+	if e.File != "" {
+		location = append(location, e.File)
+	}
+	if e.Line > 0 {
+		location = append(location, strconv.Itoa(e.Line))
+	}
+	if e.Path != "" {
+		location = append(location, e.Path)
+	}
+
+	if len(location) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(location, ":"), e.Message)
+}
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func newValidationError(message string, path ...interface{}) *ValidationError {
+	return &ValidationError{
+		Path:    formatValidationPath(path),
+		Message: message,
+		path:    path,
+	}
+}
+
+func newStrictValidationError(message string, path ...interface{}) *ValidationError {
+	validationError := newValidationError(message, path...)
+	validationError.strict = true
+	return validationError
+}
+
+// Required returns the errors which prevent the configuration from being applied (without the strict errors)
+func (e ValidationErrors) Required() ValidationErrors {
+	validationErrors := ValidationErrors{}
+	for _, validationError := range e {
+		if !validationError.strict {
+			validationErrors = append(validationErrors, validationError)
+		}
+	}
+	return validationErrors
+}
+
+func formatValidationPath(path []interface{}) string {
+	ret := ""
+	for _, part := range path {
+		switch v := part.(type) {
+		case int:
+			ret += fmt.Sprintf("[%d]", v)
+		default:
+			if ret != "" {
+				ret += "."
+			}
+			ret += fmt.Sprintf("%v", v)
+		}
+	}
+	return ret
+}
+
+// ValidateFile validates the configuration file strictly (unknown fields, selectors, keys, values and json patches)
+func ValidateFile(path string) error {
+	/* #nosec */
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if validationErrors := Validate(data, path); len(validationErrors) > 0 {
+		return validationErrors
+	}
+
+	return nil
+}
+
+// Validate validates the configuration strictly and returns all errors with the line in the configuration (where possible)
+func Validate(data []byte, file string) ValidationErrors {
+	validationErrors := ValidationErrors{}
+
+	// unknown fields and syntax errors
+	if err := yaml.UnmarshalStrict(data, &Config{}); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, message := range typeErr.Errors {
+				validationErrors = append(validationErrors, parseYamlError(message))
+			}
+		} else {
+			validationErrors = append(validationErrors, parseYamlError(err.Error()))
+			for _, validationError := range validationErrors {
+				validationError.File = file
+			}
+			// syntax error, not possible to continue
+			return validationErrors
+		}
+	}
+
+	conf := &Config{}
+	if err := yaml.Unmarshal(data, conf); err != nil {
+		// already reported by strict parsing
+		conf = &Config{}
+	}
+	validationErrors = append(validationErrors, conf.Validate()...)
+
+	// lookup lines of errors
+	root := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(data, root); err != nil {
+		root = nil
+	}
+	for _, validationError := range validationErrors {
+		validationError.File = file
+		if validationError.Line == 0 && root != nil {
+			validationError.Line = lookupYamlLine(root, validationError.path)
+		}
+	}
+
+	sort.SliceStable(validationErrors, func(i, j int) bool {
+		return validationErrors[i].Line < validationErrors[j].Line
+	})
+
+	return validationErrors
+}
+
+// Validate validates pool names, selectors, keys, values and json patches of the configuration strictly,
+// see ValidationErrors.Required for the errors which prevent the configuration from being applied
+func (c *Config) Validate() ValidationErrors {
+	validationErrors := ValidationErrors{}
+
+	switch c.GetPoolMode() {
+	case PoolModeAll, PoolModeFirstMatch:
+	default:
+		validationErrors = append(validationErrors, newValidationError(fmt.Sprintf(`invalid poolMode "%v", expected "%v" or "%v"`, c.PoolMode, PoolModeAll, PoolModeFirstMatch), "poolMode"))
+	}
+
+	if c.ReadinessGate != nil {
+		validationErrors = append(validationErrors, c.ReadinessGate.validate("readinessGate")...)
+	}
+
+	poolNames := map[string]int{}
+	for num := range c.Pools {
+		poolConfig := &c.Pools[num]
+
+		if poolConfig.Name == "" {
+			validationErrors = append(validationErrors, newStrictValidationError("pool name is empty", "pools", num))
+		} else if previousNum, exists := poolNames[poolConfig.Name]; exists {
+			validationErrors = append(validationErrors, newValidationError(fmt.Sprintf(`duplicate pool name "%v" (already used by pools[%d])`, poolConfig.Name, previousNum), "pools", num, "pool"))
+		} else {
+			poolNames[poolConfig.Name] = num
+		}
+
+		for _, validationError := range poolConfig.Validate() {
+			validationError.path = append([]interface{}{"pools", num}, validationError.path...)
+			validationError.Path = formatValidationPath(validationError.path)
+			validationErrors = append(validationErrors, validationError)
+		}
+	}
+
+	return validationErrors
+}
+
+// Validate validates selectors, keys, values and json patches of the pool
+func (p *PoolConfig) Validate() ValidationErrors {
+	validationErrors := ValidationErrors{}
+
+	// labelSelector and fieldSelector
+	if p.LabelSelector != "" {
+		if _, err := labels.Parse(p.LabelSelector); err != nil {
+			validationErrors = append(validationErrors, newValidationError(fmt.Sprintf("invalid labelSelector: %v", err), "labelSelector"))
+		}
+	}
+
+	if p.FieldSelector != "" {
+		if _, err := parseNodeFieldSelector(p.FieldSelector); err != nil {
+			validationErrors = append(validationErrors, newValidationError(fmt.Sprintf("invalid fieldSelector: %v", err), "fieldSelector"))
+		}
+	}
+
+	// readiness gate
+	if p.ReadinessGate != nil {
+		validationErrors = append(validationErrors, p.ReadinessGate.validate("readinessGate")...)
+	}
+
+	// selectors
+	for num := range p.Selector {
+		validationErrors = append(validationErrors, p.Selector[num].validate(p.Name, "selector", num)...)
+	}
+
+	// roles
+	for roleName, roleValue := range p.Node.Roles.Entries() {
+		validationErrors = append(validationErrors, validateLabel(fmt.Sprintf("node-role.kubernetes.io/%s", roleName), roleValue, "node", "roles", roleName)...)
+	}
+
+	// labels
+	for labelName, labelValue := range p.Node.Labels.Entries() {
+		validationErrors = append(validationErrors, validateLabel(labelName, labelValue, "node", "labels", labelName)...)
+	}
+
+	// annotations
+	for annotationName := range p.Node.Annotations.Entries() {
+		for _, message := range validation.IsQualifiedName(annotationName) {
+			validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`invalid annotation key "%v": %v`, annotationName, message), "node", "annotations", annotationName))
+		}
+	}
+
+	// taints
+	for taint, taintValue := range p.Node.Taints.Entries() {
+		taintKey, _, err := parseTaintKey(taint)
+		if err != nil {
+			validationErrors = append(validationErrors, newValidationError(err.Error(), "node", "taints", taint))
+			continue
+		}
+
+		for _, message := range validation.IsQualifiedName(taintKey) {
+			validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`invalid taint key "%v": %v`, taintKey, message), "node", "taints", taint))
+		}
+
+		if taintValue != nil {
+			for _, message := range validation.IsValidLabelValue(*taintValue) {
+				validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`invalid taint value "%v": %v`, *taintValue, message), "node", "taints", taint))
+			}
+		}
+	}
+
+	// templates
+	for _, poolTemplate := range p.templates() {
+		if _, err := parseTemplate(formatValidationPath(poolTemplate.path), poolTemplate.value); err != nil {
+			validationErrors = append(validationErrors, newValidationError(fmt.Sprintf("invalid template: %v", err), poolTemplate.path...))
+		}
+	}
+
+	// json patches
+	for num, patch := range p.Node.JsonPatches {
+		if !ContainsKey(k8s.JsonPatchOperations, patch.Op) {
+			validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`invalid json patch op "%v", expected one of %v`, patch.Op, strings.Join(k8s.JsonPatchOperations, ", ")), "node", "jsonPatches", num, "op"))
+		}
+
+		if !strings.HasPrefix(patch.Path, "/") {
+			validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`invalid json patch path "%v", expected json pointer starting with "/"`, patch.Path), "node", "jsonPatches", num, "path"))
+		}
+
+		if patch.Op != "remove" && patch.Value == nil {
+			validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`json patch op "%v" requires a value`, patch.Op), "node", "jsonPatches", num))
+		}
+	}
+
+	return validationErrors
+}
+
+func validateLabel(name string, value *string, path ...interface{}) ValidationErrors {
+	validationErrors := ValidationErrors{}
+
+	for _, message := range validation.IsQualifiedName(name) {
+		validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`invalid label key "%v": %v`, name, message), path...))
+	}
+
+	// templated values are sanitized when rendered
+	if value != nil && !isTemplate(*value) {
+		for _, message := range validation.IsValidLabelValue(*value) {
+			validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf(`invalid label value "%v": %v`, *value, message), path...))
+		}
+	}
+
+	return validationErrors
+}
+
+func parseYamlError(message string) *ValidationError {
+	validationError := &ValidationError{Message: message}
+	if match := yamlErrorLineRegexp.FindStringSubmatch(message); match != nil {
+		validationError.Line, _ = strconv.Atoi(match[1])
+		validationError.Message = match[2]
+	}
+	return validationError
+}
+
+// lookupYamlLine returns the line of the deepest node in the yaml document found for the path
+func lookupYamlLine(node *yamlv3.Node, path []interface{}) int {
+	if node.Kind == yamlv3.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	line := node.Line
+	for _, part := range path {
+		var next *yamlv3.Node
+
+		switch v := part.(type) {
+		case int:
+			if node.Kind == yamlv3.SequenceNode && v < len(node.Content) {
+				next = node.Content[v]
+				line = next.Line
+			}
+		default:
+			if node.Kind == yamlv3.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == fmt.Sprintf("%v", v) {
+						next = node.Content[i+1]
+						line = node.Content[i].Line
+						break
+					}
+				}
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		node = next
+	}
+
+	return line
+}
+
+// validate validates the selector operators and all nested selector groups
+func (selector *PoolConfigSelector) validate(name string, path ...interface{}) ValidationErrors {
+	validationErrors := ValidationErrors{}
+
+	subPath := func(keys ...interface{}) []interface{} {
+		return append(append([]interface{}{}, path...), keys...)
+	}
+
+	hasOperator := selector.Match != nil || selector.Regexp != nil || selector.Exists || selector.NotExists || selector.In != nil || selector.NotIn != nil || len(selector.comparisons()) > 0
+	groups := selector.groups()
+
+	switch {
+	case selector.Path == "" && selector.ProviderID == nil && len(groups) == 0:
+		validationErrors = append(validationErrors, newStrictValidationError("selector has neither path, providerID nor selector group (allOf, anyOf or noneOf)", path...))
+	case selector.Path == "" && hasOperator:
+		validationErrors = append(validationErrors, newStrictValidationError("selector has operators but no path", path...))
+	case selector.Path != "" && !hasOperator:
+		validationErrors = append(validationErrors, newStrictValidationError("selector has no operator (match, regexp, exists, notExists, in, notIn, gt, gte, lt or lte)", path...))
+	}
+
+	if selector.Exists && selector.NotExists {
+		validationErrors = append(validationErrors, newStrictValidationError("selector has both exists and notExists, never matching", path...))
+	}
+
+	if selector.ProviderID != nil {
+		if err := selector.ProviderID.compile(); err != nil {
+			validationErrors = append(validationErrors, newValidationError(err.Error(), subPath("providerID")...))
+		}
+	}
+
+	if selector.Regexp != nil {
+		if _, err := regexp.Compile(*selector.Regexp); err != nil {
+			validationErrors = append(validationErrors, newValidationError(fmt.Sprintf("invalid regexp: %v", err), subPath("regexp")...))
+		}
+	}
+
+	if selector.Path != "" {
+		if _, err := selector.newJsonPath(name); err != nil {
+			validationErrors = append(validationErrors, newValidationError(fmt.Sprintf("invalid JSONPath: %v", err), subPath("path")...))
+		}
+	}
+
+	if selector.Type != "" && !ContainsKey([]string{SelectorTypeInt, SelectorTypeQuantity, SelectorTypeSemver}, selector.Type) {
+		validationErrors = append(validationErrors, newValidationError(fmt.Sprintf(`invalid type "%v", expected one of %v, %v or %v`, selector.Type, SelectorTypeInt, SelectorTypeQuantity, SelectorTypeSemver), subPath("type")...))
+	} else {
+		for _, comparison := range selector.comparisons() {
+			if _, err := parseSelectorValue(selector.GetType(), *comparison.value); err != nil {
+				validationErrors = append(validationErrors, newValidationError(fmt.Sprintf("invalid %v value: %v", selector.GetType(), err), subPath(comparison.name)...))
+			}
+		}
+	}
+
+	for _, group := range groups {
+		if len(group.selectors) == 0 {
+			validationErrors = append(validationErrors, newStrictValidationError(fmt.Sprintf("selector group %v is empty", group.name), subPath(group.name)...))
+		}
+
+		for num := range group.selectors {
+			validationErrors = append(validationErrors, group.selectors[num].validate(name, subPath(group.name, num)...)...)
+		}
+	}
+
+	return validationErrors
+}
+
+// validate validates the conditions of the readiness gate
+func (gate *ReadinessGate) validate(path ...interface{}) ValidationErrors {
+	validationErrors := ValidationErrors{}
+
+	subPath := func(keys ...interface{}) []interface{} {
+		return append(append([]interface{}{}, path...), keys...)
+	}
+
+	if gate.Immediate && len(gate.Conditions) > 0 {
+		validationErrors = append(validationErrors, newStrictValidationError("readinessGate is immediate, conditions are ignored", subPath("conditions")...))
+	}
+
+	for num, condition := range gate.Conditions {
+		if condition.Type == "" {
+			validationErrors = append(validationErrors, newValidationError("readinessGate condition type is empty", subPath("conditions", num)...))
+		}
+
+		switch corev1.ConditionStatus(condition.Status) {
+		case "", corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionUnknown:
+		default:
+			validationErrors = append(validationErrors, newValidationError(fmt.Sprintf(`invalid readinessGate condition status "%v", expected one of %v, %v or %v`, condition.Status, corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionUnknown), subPath("conditions", num, "status")...))
+		}
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,71 @@
+package k8s
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ParseNodeManifests parses Node objects from YAML or JSON manifests (eg. output of "kubectl get node -o yaml"),
+// supports multiple documents and List objects
+func ParseNodeManifests(data []byte) ([]*corev1.Node, error) {
+	nodeList := []*corev1.Node{}
+
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if len(obj) == 0 {
+			// empty document
+			continue
+		}
+
+		nodes, err := parseNodeObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		nodeList = append(nodeList, nodes...)
+	}
+
+	return nodeList, nil
+}
+
+func parseNodeObject(obj map[string]interface{}) ([]*corev1.Node, error) {
+	switch kind := obj["kind"]; kind {
+	case "List", "NodeList":
+		nodeList := []*corev1.Node{}
+		items, _ := obj["items"].([]interface{})
+		for _, item := range items {
+			itemObj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid list item, expected object")
+			}
+
+			nodes, err := parseNodeObject(itemObj)
+			if err != nil {
+				return nil, err
+			}
+			nodeList = append(nodeList, nodes...)
+		}
+		return nodeList, nil
+	case "Node":
+		node := &corev1.Node{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, node); err != nil {
+			return nil, err
+		}
+		return []*corev1.Node{node}, nil
+	default:
+		return nil, fmt.Errorf(`unsupported kind "%v", expected Node or List`, kind)
+	}
+}
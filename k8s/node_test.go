@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"testing"
+)
+
+func Test_ParseNodeManifests(t *testing.T) {
+	nodeList, err := ParseNodeManifests([]byte(`
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Node
+    metadata:
+      name: node-1
+  - apiVersion: v1
+    kind: Node
+    metadata:
+      name: node-2
+---
+apiVersion: v1
+kind: Node
+metadata:
+  name: node-3
+  labels:
+    kubernetes.io/os: linux
+spec:
+  providerID: azure:///foobar
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(nodeList) != 3 {
+		t.Fatalf("Expected 3 nodes, got %v", len(nodeList))
+	}
+
+	if nodeList[2].Name != "node-3" || nodeList[2].Labels["kubernetes.io/os"] != "linux" || nodeList[2].Spec.ProviderID != "azure:///foobar" {
+		t.Errorf("Unexpected node %v", nodeList[2])
+	}
+
+	nodeList, err = ParseNodeManifests([]byte(`{"apiVersion": "v1", "kind": "Node", "metadata": {"name": "node-json"}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nodeList) != 1 || nodeList[0].Name != "node-json" {
+		t.Errorf("Unexpected nodes %v", nodeList)
+	}
+
+	if _, err := ParseNodeManifests([]byte(`{"apiVersion": "v1", "kind": "Pod"}`)); err == nil {
+		t.Error("Expected error for unsupported kind")
+	}
+}
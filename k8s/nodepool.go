@@ -0,0 +1,30 @@
+package k8s
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	NodePoolGroup    = "kube-pool-manager.webdevops.io"
+	NodePoolVersion  = "v1alpha1"
+	NodePoolResource = "nodepools"
+	NodePoolKind     = "NodePool"
+)
+
+var (
+	NodePoolGroupVersionResource = schema.GroupVersionResource{
+		Group:    NodePoolGroup,
+		Version:  NodePoolVersion,
+		Resource: NodePoolResource,
+	}
+)
+
+type (
+	NodePoolStatus struct {
+		ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+		MatchedNodes       int          `json:"matchedNodes"`
+		LastAppliedTime    *metav1.Time `json:"lastAppliedTime,omitempty"`
+		Errors             []string     `json:"errors,omitempty"`
+	}
+)
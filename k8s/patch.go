@@ -2,9 +2,18 @@ package k8s
 
 import (
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+var (
+	// JsonPatchOperations are the supported json patch operations
+	JsonPatchOperations = []string{"add", "remove", "replace", "test"}
+)
+
 type (
 	JsonPatch interface{}
 
@@ -24,9 +33,33 @@ type (
 
 	JsonPatchSet struct {
 		List map[string]JsonPatch
+
+		// Tests are "test" operations (preconditions) which are sent before all other patches,
+		// the whole patch fails if one of them doesn't match the object anymore
+		Tests map[string]JsonPatch
 	}
 )
 
+// JSONSchema returns the json schema of a json patch object
+func (JsonPatchObject) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "object",
+		"required": []string{"op", "path"},
+		"properties": map[string]interface{}{
+			"op": map[string]interface{}{
+				"type": "string",
+				"enum": JsonPatchOperations,
+			},
+			"path": map[string]interface{}{
+				"type":    "string",
+				"pattern": "^/",
+			},
+			"value": map[string]interface{}{},
+		},
+		"additionalProperties": false,
+	}
+}
+
 func PatchPathEsacpe(val string) string {
 	val = strings.ReplaceAll(val, "~", "~0")
 	val = strings.ReplaceAll(val, "/", "~1")
@@ -36,6 +69,7 @@ func PatchPathEsacpe(val string) string {
 func NewJsonPatchSet() *JsonPatchSet {
 	set := JsonPatchSet{}
 	set.List = map[string]JsonPatch{}
+	set.Tests = map[string]JsonPatch{}
 	return &set
 }
 
@@ -43,6 +77,18 @@ func (set *JsonPatchSet) AddSet(patchSet *JsonPatchSet) {
 	for _, patch := range patchSet.List {
 		set.Add(patch)
 	}
+	for _, patch := range patchSet.Tests {
+		set.AddTest(patch)
+	}
+}
+
+// AddTest adds a precondition ("test" operation) to the set, existing preconditions for the same path are replaced
+func (set *JsonPatchSet) AddTest(patch JsonPatch) {
+	op, path, _ := patchOperation(patch)
+	if op != "test" {
+		panic(fmt.Sprintf(`jsonPatch precondition for "%v" has to be a "test" operation, got "%v"`, path, op))
+	}
+	set.Tests[path] = patch
 }
 
 func (set *JsonPatchSet) Add(patch JsonPatch) {
@@ -56,11 +102,209 @@ func (set *JsonPatchSet) Add(patch JsonPatch) {
 	}
 }
 
-func (set *JsonPatchSet) Marshal() ([]byte, error) {
+// Patches returns the list of patches ordered by path
+func (set *JsonPatchSet) Patches() []JsonPatch {
+	pathList := make([]string, 0, len(set.List))
+	for path := range set.List {
+		pathList = append(pathList, path)
+	}
+	sort.Strings(pathList)
+
+	patchList := []JsonPatch{}
+	for _, path := range pathList {
+		patchList = append(patchList, set.List[path])
+	}
+
+	return patchList
+}
+
+// Operations returns all operations which are sent, preconditions are placed before all other patches
+func (set *JsonPatchSet) Operations() []JsonPatch {
 	patchList := []JsonPatch{}
+	if len(set.Tests) > 0 {
+		patchList = append(patchList, (&JsonPatchSet{List: set.Tests}).Patches()...)
+	}
+	return append(patchList, set.Patches()...)
+}
+
+// Marshal returns the json patch, preconditions are placed before all other patches
+func (set *JsonPatchSet) Marshal() ([]byte, error) {
+	return json.Marshal(set.Operations())
+}
+
+// Len returns the number of patches in the set (without preconditions)
+func (set *JsonPatchSet) Len() int {
+	return len(set.List)
+}
+
+// Diff returns a new patch set only containing the patches which would change the object
+// (add/replace with a different value, remove of an existing path, all other operations are kept),
+// preconditions (Tests) are not counted as changes and are kept only if at least one patch is left
+func (set *JsonPatchSet) Diff(obj interface{}) (*JsonPatchSet, error) {
+	doc, err := normalizeJsonValue(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	diffSet := NewJsonPatchSet()
 	for _, patch := range set.List {
-		patchList = append(patchList, patch)
+		op, path, value := patchOperation(patch)
+
+		currentValue, exists := lookupPatchPath(doc, path)
+		switch op {
+		case "add", "replace":
+			patchValue, err := normalizeJsonValue(value)
+			if err != nil {
+				return nil, err
+			}
+
+			if exists && reflect.DeepEqual(currentValue, patchValue) {
+				continue
+			}
+
+			// kubernetes omits empty fields, so a missing path is equal to an empty value
+			if !exists && isEmptyJsonValue(patchValue) {
+				continue
+			}
+		case "remove":
+			if !exists {
+				continue
+			}
+		}
+
+		diffSet.Add(patch)
+	}
+
+	if diffSet.Len() > 0 {
+		for _, patch := range set.Tests {
+			diffSet.AddTest(patch)
+		}
+	}
+
+	return diffSet, nil
+}
+
+// Summary returns a human readable summary of the changed keys (eg. for events),
+// eg. "set labels foo, bar; removed annotations baz; updated taints"
+func (set *JsonPatchSet) Summary() string {
+	sections := []string{}
+	keys := map[string][]string{}
+	add := func(section, key string) {
+		if _, exists := keys[section]; !exists {
+			sections = append(sections, section)
+		}
+		keys[section] = append(keys[section], key)
+	}
+
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for _, patch := range set.Patches() {
+		op, path, _ := patchOperation(patch)
+
+		action := "set"
+		if op == "remove" {
+			action = "removed"
+		}
+
+		switch {
+		case strings.HasPrefix(path, "/metadata/labels/"):
+			add(action+" labels", unescape.Replace(strings.TrimPrefix(path, "/metadata/labels/")))
+		case strings.HasPrefix(path, "/metadata/annotations/"):
+			add(action+" annotations", unescape.Replace(strings.TrimPrefix(path, "/metadata/annotations/")))
+		case path == "/spec/taints":
+			add("updated taints", "")
+		default:
+			add(op, path)
+		}
+	}
+
+	ret := []string{}
+	for _, section := range sections {
+		sectionKeys := []string{}
+		for _, key := range keys[section] {
+			if key != "" {
+				sectionKeys = append(sectionKeys, key)
+			}
+		}
+
+		if len(sectionKeys) > 0 {
+			ret = append(ret, fmt.Sprintf("%s %s", section, strings.Join(sectionKeys, ", ")))
+		} else {
+			ret = append(ret, section)
+		}
+	}
+	return strings.Join(ret, "; ")
+}
+
+func patchOperation(patch JsonPatch) (op, path string, value interface{}) {
+	switch v := patch.(type) {
+	case JsonPatchString:
+		if v.Value != nil {
+			value = *v.Value
+		}
+		return v.Op, v.Path, value
+	case JsonPatchObject:
+		return v.Op, v.Path, v.Value
+	default:
+		panic("jsonPatch type not defined or allowed")
+	}
+}
+
+// normalizeJsonValue converts the value to its generic json representation
+func normalizeJsonValue(val interface{}) (ret interface{}, err error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &ret)
+	return
+}
+
+func isEmptyJsonValue(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// lookupPatchPath resolves a json pointer (RFC 6901) inside a normalized json document
+func lookupPatchPath(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+
+	current := doc
+	for _, part := range strings.Split(path[1:], "/") {
+		part = strings.ReplaceAll(part, "~1", "/")
+		part = strings.ReplaceAll(part, "~0", "~")
+
+		switch v := current.(type) {
+		case map[string]interface{}:
+			val, exists := v[part]
+			if !exists {
+				return nil, false
+			}
+			current = val
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			current = v[index]
+		default:
+			return nil, false
+		}
 	}
 
-	return json.Marshal(patchList)
+	return current, true
 }
@@ -0,0 +1,151 @@
+package k8s
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func stringPtr(val string) *string {
+	return &val
+}
+
+func buildNode() *corev1.Node {
+	node := corev1.Node{}
+	node.ObjectMeta.Labels = map[string]string{
+		"node.kubernetes.io/role":        "worker",
+		"node-role.kubernetes.io/worker": "",
+	}
+	node.ObjectMeta.Annotations = map[string]string{
+		"webdevops.io/foobar": "barfoo",
+	}
+	node.Spec.Taints = []corev1.Taint{
+		{Key: "dedicated", Value: "worker", Effect: corev1.TaintEffectNoSchedule},
+	}
+
+	return &node
+}
+
+func Test_PatchPathLookup(t *testing.T) {
+	doc, err := normalizeJsonValue(buildNode())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if val, exists := lookupPatchPath(doc, "/metadata/labels/node.kubernetes.io~1role"); !exists || val != "worker" {
+		t.Errorf("Expected escaped label path to resolve, got %v", val)
+	}
+
+	if val, exists := lookupPatchPath(doc, "/spec/taints/0/key"); !exists || val != "dedicated" {
+		t.Errorf("Expected array index path to resolve, got %v", val)
+	}
+
+	for _, path := range []string{"/metadata/labels/missing", "/spec/taints/1", "/spec/taints/foo", "metadata"} {
+		if _, exists := lookupPatchPath(doc, path); exists {
+			t.Errorf("Expected path \"%s\" not to exist", path)
+		}
+	}
+}
+
+func Test_PatchSetDiff(t *testing.T) {
+	node := buildNode()
+
+	patchSet := NewJsonPatchSet()
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/labels/node.kubernetes.io~1role", Value: stringPtr("worker")})
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/labels/node-role.kubernetes.io~1worker", Value: stringPtr("")})
+	patchSet.Add(JsonPatchString{Op: "remove", Path: "/metadata/labels/missing"})
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/annotations/webdevops.io~1foobar", Value: stringPtr("barfoo")})
+	patchSet.Add(JsonPatchObject{Op: "add", Path: "/spec/taints", Value: []corev1.Taint{
+		{Key: "dedicated", Value: "worker", Effect: corev1.TaintEffectNoSchedule},
+	}})
+	patchSet.Add(JsonPatchObject{Op: "add", Path: "/spec/podCIDRs", Value: []string{}})
+
+	diffSet, err := patchSet.Diff(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diffSet.Len() != 0 {
+		t.Errorf("Expected empty diff, got %v", diffSet.List)
+	}
+
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/labels/node.kubernetes.io~1role", Value: stringPtr("agent")})
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/labels/new", Value: stringPtr("")})
+	patchSet.Add(JsonPatchString{Op: "remove", Path: "/metadata/annotations/webdevops.io~1foobar"})
+	patchSet.Add(JsonPatchObject{Op: "add", Path: "/spec/taints", Value: []corev1.Taint{}})
+	patchSet.Add(JsonPatchString{Op: "test", Path: "/metadata/labels/missing", Value: stringPtr("foobar")})
+
+	diffSet, err = patchSet.Diff(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedPaths := []string{
+		"/metadata/labels/node.kubernetes.io~1role",
+		"/metadata/labels/new",
+		"/metadata/annotations/webdevops.io~1foobar",
+		"/spec/taints",
+	}
+	if diffSet.Len() != len(expectedPaths)+1 {
+		t.Errorf("Expected %v patches in diff, got %v", len(expectedPaths)+1, diffSet.List)
+	}
+	for _, path := range expectedPaths {
+		if _, exists := diffSet.List[path]; !exists {
+			t.Errorf("Expected patch \"%s\" in diff", path)
+		}
+	}
+}
+
+func Test_PatchSetPreconditions(t *testing.T) {
+	node := buildNode()
+
+	patchSet := NewJsonPatchSet()
+	patchSet.Add(JsonPatchObject{Op: "add", Path: "/spec/taints", Value: []corev1.Taint{}})
+	patchSet.AddTest(JsonPatchObject{Op: "test", Path: "/spec/taints", Value: node.Spec.Taints})
+
+	data, err := patchSet.Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `[{"op":"test","path":"/spec/taints","value":[{"key":"dedicated","value":"worker","effect":"NoSchedule"}]},{"op":"add","path":"/spec/taints","value":[]}]`
+	if string(data) != expected {
+		t.Errorf("Expected precondition before patches:\n%v\ngot:\n%v", expected, string(data))
+	}
+
+	diffSet, err := patchSet.Diff(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diffSet.Len() != 1 || len(diffSet.Tests) != 1 {
+		t.Errorf("Expected patch and precondition to be kept, got %v", diffSet)
+	}
+
+	// preconditions alone are not sent
+	patchSet.Add(JsonPatchObject{Op: "add", Path: "/spec/taints", Value: node.Spec.Taints})
+	diffSet, err = patchSet.Diff(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diffSet.Len() != 0 || len(diffSet.Tests) != 0 {
+		t.Errorf("Expected empty patch set, got %v", diffSet)
+	}
+}
+
+func Test_PatchSetSummary(t *testing.T) {
+	patchSet := NewJsonPatchSet()
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/labels/webdevops.io~1vmss", Value: stringPtr("aks-agents")})
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/labels/node-role.kubernetes.io~1agent", Value: stringPtr("")})
+	patchSet.Add(JsonPatchString{Op: "remove", Path: "/metadata/labels/webdevops.io~1legacy"})
+	patchSet.Add(JsonPatchString{Op: "replace", Path: "/metadata/annotations/webdevops.io~1foobar", Value: stringPtr("barfoo")})
+	patchSet.Add(JsonPatchObject{Op: "add", Path: "/spec/taints", Value: []corev1.Taint{}})
+	patchSet.Add(JsonPatchObject{Op: "replace", Path: "/spec/configSource", Value: map[string]string{}})
+
+	expected := "set annotations webdevops.io/foobar; set labels node-role.kubernetes.io/agent, webdevops.io/vmss; removed labels webdevops.io/legacy; replace /spec/configSource; updated taints"
+	if summary := patchSet.Summary(); summary != expected {
+		t.Errorf("Expected summary %q, got %q", expected, summary)
+	}
+
+	if summary := NewJsonPatchSet().Summary(); summary != "" {
+		t.Errorf("Expected empty summary, got %q", summary)
+	}
+}
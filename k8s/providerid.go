@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"strings"
+)
+
+const (
+	ProviderAzure = "azure"
+	ProviderAWS   = "aws"
+	ProviderGCE   = "gce"
+)
+
+type (
+	// ProviderID contains the fields of a parsed node spec.providerID, fields not provided by the cloud provider are empty
+	ProviderID struct {
+		// Provider is the scheme of the providerID (azure, aws, gce)
+		Provider string `json:"provider"`
+
+		// Azure
+		Subscription  string `json:"subscription,omitempty"`
+		ResourceGroup string `json:"resourceGroup,omitempty"`
+		ScaleSet      string `json:"scaleSet,omitempty"`
+
+		// AWS and GCP
+		Zone string `json:"zone,omitempty"`
+
+		// AWS
+		InstanceID string `json:"instanceID,omitempty"`
+
+		// GCP
+		Project string `json:"project,omitempty"`
+
+		// Instance is the vmss instance id or vm name (Azure) or the instance name (GCP)
+		Instance string `json:"instance,omitempty"`
+	}
+)
+
+// ParseProviderID parses the providerID of a node, supported formats:
+//
+//	azure:///subscriptions/<subscription>/resourceGroups/<resourceGroup>/providers/Microsoft.Compute/virtualMachineScaleSets/<scaleSet>/virtualMachines/<instance>
+//	azure:///subscriptions/<subscription>/resourceGroups/<resourceGroup>/providers/Microsoft.Compute/virtualMachines/<instance>
+//	aws:///<zone>/<instanceID>
+//	gce://<project>/<zone>/<instance>
+//
+// unknown providers only set the provider field
+func ParseProviderID(providerID string) *ProviderID {
+	ret := &ProviderID{}
+
+	provider, resource, found := strings.Cut(providerID, "://")
+	if !found {
+		return ret
+	}
+	ret.Provider = provider
+
+	parts := strings.Split(strings.Trim(resource, "/"), "/")
+
+	switch provider {
+	case ProviderAzure:
+		// resource ids are case insensitive
+		for i := 0; i+1 < len(parts); i += 2 {
+			value := parts[i+1]
+			switch strings.ToLower(parts[i]) {
+			case "subscriptions":
+				ret.Subscription = value
+			case "resourcegroups":
+				ret.ResourceGroup = value
+			case "virtualmachinescalesets":
+				ret.ScaleSet = value
+			case "virtualmachines":
+				ret.Instance = value
+			}
+		}
+	case ProviderAWS:
+		switch len(parts) {
+		case 1:
+			ret.InstanceID = parts[0]
+		case 2:
+			ret.Zone = parts[0]
+			ret.InstanceID = parts[1]
+		}
+	case ProviderGCE:
+		if len(parts) == 3 {
+			ret.Project = parts[0]
+			ret.Zone = parts[1]
+			ret.Instance = parts[2]
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"testing"
+)
+
+func Test_ParseProviderID(t *testing.T) {
+	testCases := map[string]ProviderID{
+		"azure:///subscriptions/d86bcf13-ddf7-45ea-82f1-6f656767a318/resourceGroups/mc_k8s_mblaschke_westeurope/providers/Microsoft.Compute/virtualMachineScaleSets/aks-agents-35471996-vmss/virtualMachines/30": {
+			Provider:      ProviderAzure,
+			Subscription:  "d86bcf13-ddf7-45ea-82f1-6f656767a318",
+			ResourceGroup: "mc_k8s_mblaschke_westeurope",
+			ScaleSet:      "aks-agents-35471996-vmss",
+			Instance:      "30",
+		},
+		"azure:///subscriptions/d86bcf13-ddf7-45ea-82f1-6f656767a318/resourcegroups/mc_k8s/providers/Microsoft.Compute/virtualMachines/aks-system-vm-0": {
+			Provider:      ProviderAzure,
+			Subscription:  "d86bcf13-ddf7-45ea-82f1-6f656767a318",
+			ResourceGroup: "mc_k8s",
+			Instance:      "aks-system-vm-0",
+		},
+		"aws:///eu-central-1a/i-0123456789abcdef0": {
+			Provider:   ProviderAWS,
+			Zone:       "eu-central-1a",
+			InstanceID: "i-0123456789abcdef0",
+		},
+		"gce://my-project/europe-west1-b/gke-cluster-default-pool-1234abcd-wxyz": {
+			Provider: ProviderGCE,
+			Project:  "my-project",
+			Zone:     "europe-west1-b",
+			Instance: "gke-cluster-default-pool-1234abcd-wxyz",
+		},
+		"kind://docker/kind/kind-control-plane": {
+			Provider: "kind",
+		},
+		"": {},
+	}
+
+	for providerID, expected := range testCases {
+		if parsed := ParseProviderID(providerID); *parsed != expected {
+			t.Errorf("Expected %q to be parsed as %+v, got %+v", providerID, expected, *parsed)
+		}
+	}
+}
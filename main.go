@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v2"
 
 	"github.com/webdevops/kube-pool-manager/config"
 	"github.com/webdevops/kube-pool-manager/manager"
@@ -33,24 +35,73 @@ func main() {
 	initArgparser()
 	initLogger()
 
+	if argparser.Active != nil {
+		runCommand(argparser.Active.Name)
+		return
+	}
+
 	logger.Infof("starting kube-pool-manager v%s (%s; %s; by %v)", gitTag, gitCommit, runtime.Version(), Author)
 	logger.Info(string(Opts.GetJson()))
 	initSystem()
 
 	poolManager := manager.KubePoolManager{
 		Opts:   Opts,
-		Config: parseAppConfig(Opts.Config),
 		Logger: logger,
 	}
-	poolManager.Init()
-	poolManager.Start()
+	appConfig := &config.Config{}
+	if Opts.Config != "" {
+		appConfig = parseAppConfig(Opts.Config)
+	} else {
+		logger.Info("no configuration file set, using NodePools only")
+	}
+	if err := poolManager.SetConfig(appConfig); err != nil {
+		logger.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	poolManager.Init(ctx)
+	if err := poolManager.Start(ctx); err != nil {
+		logger.Fatal(err)
+	}
 
 	logger.Infof("starting http server on %s", Opts.Server.Bind)
-	startHttpServer()
+	srv := startHttpServer(&poolManager)
+
+	<-ctx.Done()
+	stop()
+	logger.Infof("shutting down (grace period %v)", Opts.Shutdown.Timeout)
+
+	// each shutdown phase has its own grace period, a slow worker drain must not cut off the http shutdown
+	managerShutdownCtx, managerCancel := context.WithTimeout(context.Background(), Opts.Shutdown.Timeout)
+	defer managerCancel()
+	poolManager.Shutdown(managerShutdownCtx)
+
+	serverShutdownCtx, serverCancel := context.WithTimeout(context.Background(), Opts.Shutdown.ServerTimeout)
+	defer serverCancel()
+	if err := srv.Shutdown(serverShutdownCtx); err != nil {
+		logger.Errorf("failed to shutdown http server: %v", err)
+	}
+	logger.Info("shutdown complete")
 }
 
 func initArgparser() {
 	argparser = flags.NewParser(&Opts, flags.Default)
+	argparser.SubcommandsOptional = true
+
+	if _, err := argparser.AddCommand("explain", "Explain pool evaluation for node manifests", "Evaluates the pool configuration against Node manifests (YAML/JSON) and prints selector values, matching pools and the json patch, no cluster access required", &explainCommand); err != nil {
+		panic(err)
+	}
+
+	if _, err := argparser.AddCommand("validate", "Validate config files", "Validates config files strictly (unknown fields, selectors, keys, values and json patches) and prints all errors with file and line", &validateCommand); err != nil {
+		panic(err)
+	}
+
+	if _, err := argparser.AddCommand("schema", "Print json schema of config file", "Prints the json schema of the config file (eg. for editors and CI validation)", &schemaCommand); err != nil {
+		panic(err)
+	}
+
 	_, err := argparser.Parse()
 
 	// check if there is an parse error
@@ -64,53 +115,85 @@ func initArgparser() {
 			os.Exit(1)
 		}
 	}
+
+	configRequired := !Opts.NodePool.Enabled
+	if argparser.Active != nil {
+		switch argparser.Active.Name {
+		case "explain":
+			configRequired = true
+		case "validate":
+			configRequired = len(validateCommand.Args.Files) == 0
+		case "schema":
+			configRequired = false
+		}
+	}
+
+	if Opts.Config == "" && configRequired {
+		fmt.Println("the required flag `--config' was not specified (only optional if `--nodepool.crd' is enabled)")
+		fmt.Println()
+		argparser.WriteHelp(os.Stdout)
+		os.Exit(1)
+	}
 }
 
-func parseAppConfig(path string) (conf config.Config) {
-	var configRaw []byte
+func runCommand(name string) {
+	var err error
 
-	conf = config.Config{}
+	switch name {
+	case "explain":
+		err = runExplain(os.Stdout)
+	case "validate":
+		err = runValidate(os.Stdout)
+	case "schema":
+		err = runSchema(os.Stdout)
+	}
 
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func parseAppConfig(path string) *config.Config {
 	logger.With(zap.String("path", path)).Infof("reading configuration from file %v", path)
-	/* #nosec */
-	if data, err := os.ReadFile(path); err == nil {
-		configRaw = data
-	} else {
-		logger.Fatal(err)
+
+	if Opts.ConfigStrict {
+		if err := config.ValidateFile(path); err != nil {
+			logger.Fatalf("strict config validation failed:\n%v", err)
+		}
 	}
 
-	logger.With(zap.String("path", path)).Info("parsing configuration")
-	if err := yaml.Unmarshal(configRaw, &conf); err != nil {
+	conf, err := config.ParseFile(path)
+	if err != nil {
 		logger.Fatal(err)
 	}
 
-	return
+	return conf
 }
 
-func startHttpServer() {
+// startHttpServer starts the http server in the background, the returned server has to be shut down by the caller
+func startHttpServer(poolManager *manager.KubePoolManager) *http.Server {
 	mux := http.NewServeMux()
 
-	// healthz
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := fmt.Fprint(w, "Ok"); err != nil {
-			logger.Error(err)
-		}
-	})
-
-	// readyz
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := fmt.Fprint(w, "Ok"); err != nil {
-			logger.Error(err)
-		}
-	})
+	// healthz and readyz
+	poolManager.RegisterHealthHandlers(mux)
 
 	mux.Handle("/metrics", promhttp.Handler())
 
+	// introspection api
+	poolManager.RegisterApiHandlers(mux)
+
 	srv := &http.Server{
 		Addr:         Opts.Server.Bind,
 		Handler:      mux,
 		ReadTimeout:  Opts.Server.ReadTimeout,
 		WriteTimeout: Opts.Server.WriteTimeout,
 	}
-	logger.Fatal(srv.ListenAndServe())
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal(err)
+		}
+	}()
+
+	return srv
 }
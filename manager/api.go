@@ -0,0 +1,181 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+type (
+	// ApiPools is the response of /api/pools
+	ApiPools struct {
+		Hash          string                `json:"hash"`
+		PoolMode      string                `json:"poolMode"`
+		ReadinessGate *config.ReadinessGate `json:"readinessGate,omitempty"`
+		Pools         []*ApiPool            `json:"pools"`
+	}
+
+	ApiPool struct {
+		Name         string                 `json:"name"`
+		MatchedNodes int                    `json:"matchedNodes"`
+		Config       map[string]interface{} `json:"config"`
+	}
+
+	// ApiNode is an entry of the response of /api/nodes
+	ApiNode struct {
+		Name                  string     `json:"name"`
+		Pools                 []string   `json:"pools"`
+		LastApplied           *time.Time `json:"lastApplied,omitempty"`
+		LastError             string     `json:"lastError,omitempty"`
+		AppliedSinceReconcile bool       `json:"appliedSinceReconcile"`
+	}
+
+	ApiError struct {
+		Error string `json:"error"`
+	}
+
+	// nodeApplyStatus is the result of the last apply of a node
+	nodeApplyStatus struct {
+		lastApplied time.Time
+		lastError   string
+	}
+)
+
+// RegisterApiHandlers registers the read-only introspection api
+func (m *KubePoolManager) RegisterApiHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/pools", m.handleApiPools)
+	mux.HandleFunc("GET /api/nodes", m.handleApiNodes)
+	mux.HandleFunc("GET /api/nodes/{name}/explain", m.handleApiNodeExplain)
+}
+
+// handleApiPools returns the active configuration with the number of matched nodes of each pool
+func (m *KubePoolManager) handleApiPools(w http.ResponseWriter, r *http.Request) {
+	conf := m.GetConfig()
+
+	matchedNodes := map[string]int{}
+	m.nodePatchStatusLock.RLock()
+	for _, poolNameList := range m.nodePoolMembership {
+		for _, poolName := range poolNameList {
+			matchedNodes[poolName]++
+		}
+	}
+	m.nodePatchStatusLock.RUnlock()
+
+	response := ApiPools{
+		PoolMode:      conf.GetPoolMode(),
+		ReadinessGate: conf.ReadinessGate,
+		Pools:         []*ApiPool{},
+	}
+	if fileConfig := m.fileConfig.Load(); fileConfig != nil {
+		response.Hash = fileConfig.Hash()
+	}
+
+	for num := range conf.Pools {
+		poolConfig, err := conf.Pools[num].AsMap()
+		if err != nil {
+			m.writeApiError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response.Pools = append(response.Pools, &ApiPool{
+			Name:         conf.Pools[num].Name,
+			MatchedNodes: matchedNodes[conf.Pools[num].Name],
+			Config:       poolConfig,
+		})
+	}
+
+	m.writeApiResponse(w, http.StatusOK, response)
+}
+
+// handleApiNodes returns all nodes with their matched pools and the status of the last apply
+func (m *KubePoolManager) handleApiNodes(w http.ResponseWriter, r *http.Request) {
+	if !m.nodeWatchReady.Load() {
+		m.writeApiErrorMessage(w, http.StatusServiceUnavailable, "node watch is not ready")
+		return
+	}
+
+	nodeList, err := m.getNodeLister().List(labels.Everything())
+	if err != nil {
+		m.writeApiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sort.Slice(nodeList, func(i, j int) bool {
+		return nodeList[i].Name < nodeList[j].Name
+	})
+
+	response := []*ApiNode{}
+	m.nodePatchStatusLock.RLock()
+	for _, node := range nodeList {
+		apiNode := &ApiNode{
+			Name:                  node.Name,
+			Pools:                 []string{},
+			AppliedSinceReconcile: m.nodePatchStatus[node.Name],
+		}
+
+		if poolNameList, exists := m.nodePoolMembership[node.Name]; exists && poolNameList != nil {
+			apiNode.Pools = poolNameList
+		}
+
+		if applyStatus, exists := m.nodeApplyStatus[node.Name]; exists {
+			if !applyStatus.lastApplied.IsZero() {
+				lastApplied := applyStatus.lastApplied
+				apiNode.LastApplied = &lastApplied
+			}
+			apiNode.LastError = applyStatus.lastError
+		}
+
+		response = append(response, apiNode)
+	}
+	m.nodePatchStatusLock.RUnlock()
+
+	m.writeApiResponse(w, http.StatusOK, response)
+}
+
+// handleApiNodeExplain returns the evaluation of all pools and the patch which would be sent to the node
+func (m *KubePoolManager) handleApiNodeExplain(w http.ResponseWriter, r *http.Request) {
+	if !m.nodeWatchReady.Load() {
+		m.writeApiErrorMessage(w, http.StatusServiceUnavailable, "node watch is not ready")
+		return
+	}
+
+	node, err := m.getNodeLister().Get(r.PathValue("name"))
+	if k8serrors.IsNotFound(err) {
+		m.writeApiError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		m.writeApiError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	startupTaint := ""
+	if m.Opts.StartupTaint.Enabled {
+		startupTaint = m.Opts.StartupTaint.Taint
+	}
+
+	m.writeApiResponse(w, http.StatusOK, m.GetConfig().Explain(node, startupTaint))
+}
+
+func (m *KubePoolManager) writeApiError(w http.ResponseWriter, statusCode int, err error) {
+	m.writeApiErrorMessage(w, statusCode, err.Error())
+}
+
+func (m *KubePoolManager) writeApiErrorMessage(w http.ResponseWriter, statusCode int, message string) {
+	m.writeApiResponse(w, statusCode, ApiError{Error: message})
+}
+
+func (m *KubePoolManager) writeApiResponse(w http.ResponseWriter, statusCode int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(response); err != nil {
+		m.Logger.Error(err)
+	}
+}
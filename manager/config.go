@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+// SetConfig replaces the pool configuration from the configuration file,
+// an invalid configuration is rejected and the previous configuration is kept active
+func (m *KubePoolManager) SetConfig(conf *config.Config) error {
+	m.configLock.Lock()
+	defer m.configLock.Unlock()
+
+	activeConf, err := m.buildConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	m.fileConfig.Store(conf)
+	previousConf := m.poolConfig.Swap(activeConf)
+	m.updateConfigMetrics()
+	m.deleteRemovedPoolMetrics(previousConf, activeConf)
+	return nil
+}
+
+// updateConfig rebuilds the active pool configuration after NodePools were changed
+func (m *KubePoolManager) updateConfig() {
+	m.configLock.Lock()
+	defer m.configLock.Unlock()
+
+	activeConf, err := m.buildConfig(m.fileConfig.Load())
+	if err != nil {
+		m.Logger.Errorf("invalid pool configuration, keeping previous configuration: %v", err)
+		return
+	}
+
+	previousConf := m.poolConfig.Swap(activeConf)
+	m.updateConfigMetrics()
+	m.deleteRemovedPoolMetrics(previousConf, activeConf)
+}
+
+// buildConfig builds the active pool configuration from configuration file and NodePools and validates it
+func (m *KubePoolManager) buildConfig(conf *config.Config) (*config.Config, error) {
+	if nodePools := m.nodePools.Load(); nodePools != nil {
+		conf = conf.WithNodePools(*nodePools)
+	}
+
+	// nodes are protected by the startup taint, configuration is applied immediately by default
+	if m.Opts.StartupTaint.Enabled {
+		conf = conf.WithStartupTaint()
+	}
+
+	// strict errors only reject the configuration with --config.strict
+	validationErrors := conf.Validate()
+	if !m.Opts.ConfigStrict {
+		validationErrors = validationErrors.Required()
+	}
+	if len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	return conf, nil
+}
+
+// GetConfig returns the active pool configuration
+func (m *KubePoolManager) GetConfig() *config.Config {
+	return m.poolConfig.Load()
+}
+
+// startConfigWatch checks the config file periodically for changes,
+// ConfigMap volumes are updated by swapping symlinks, so the file content is compared instead of using file events
+func (m *KubePoolManager) startConfigWatch() {
+	if !m.Opts.ConfigWatch.Enabled || m.Opts.Config == "" {
+		return
+	}
+
+	go func() {
+		contextLogger := m.Logger.With(zap.String("path", m.Opts.Config))
+		contextLogger.Infof("watching config file %v for changes (interval %v)", m.Opts.Config, m.Opts.ConfigWatch.Interval)
+
+		lastHash := m.fileConfig.Load().Hash()
+
+		ticker := time.NewTicker(m.Opts.ConfigWatch.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+				/* #nosec */
+				data, err := os.ReadFile(m.Opts.Config)
+				if err != nil {
+					contextLogger.Errorf("failed to read configuration file: %v", err)
+					continue
+				}
+
+				// file was not changed since last reload (or last failed reload)
+				if hash := config.Checksum(data); hash == lastHash {
+					continue
+				} else {
+					lastHash = hash
+				}
+
+				m.reloadConfig(contextLogger, data)
+			}
+		}
+	}()
+}
+
+// reloadConfig validates the new configuration and replaces the active configuration,
+// a broken configuration keeps the previous configuration active
+func (m *KubePoolManager) reloadConfig(contextLogger *zap.SugaredLogger, data []byte) {
+	conf, err := config.Parse(data)
+	if err == nil && m.Opts.ConfigStrict {
+		if validationErrors := config.Validate(data, m.Opts.Config); len(validationErrors) > 0 {
+			err = validationErrors
+		}
+	}
+	if err == nil {
+		err = m.SetConfig(conf)
+	}
+	if err != nil {
+		contextLogger.Errorf("failed to reload configuration, keeping previous configuration: %v", err)
+		m.prometheus.configReload.WithLabelValues("failed").Inc()
+		m.prometheus.configReloadStatus.Set(0)
+		return
+	}
+
+	contextLogger.Infof("configuration changed, activated new configuration (hash %v)", conf.Hash())
+	m.prometheus.configReload.WithLabelValues("success").Inc()
+	m.prometheus.configReloadStatus.Set(1)
+	m.prometheus.configReloadTime.SetToCurrentTime()
+
+	// reconcile all nodes with the new configuration
+	if m.nodeWatchReady.Load() {
+		contextLogger.Info("reapply node pool settings")
+		if err := m.startupApply(m.ctx); err != nil {
+			contextLogger.Errorf("failed to reapply node pool settings: %v", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+const (
+	EventComponent = "kube-pool-manager"
+
+	EventReasonPoolsApplied    = "PoolsApplied"
+	EventReasonPatchFailed     = "PatchFailed"
+	EventReasonPoolNotMatching = "PoolNotMatching"
+	EventReasonPoolFailed      = "PoolFailed"
+)
+
+// initEvents creates the event recorder for node events (if enabled)
+func (m *KubePoolManager) initEvents() {
+	if !m.Opts.Events.Enabled {
+		return
+	}
+
+	eventBroadcaster := record.NewBroadcaster(record.WithContext(m.ctx))
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: m.k8sClient.CoreV1().Events("")})
+	m.eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: EventComponent})
+
+	go func() {
+		<-m.ctx.Done()
+		eventBroadcaster.Shutdown()
+	}()
+}
+
+// recordNodeEvent creates an event for the node, no events are created if disabled or in dry-run mode
+func (m *KubePoolManager) recordNodeEvent(node *corev1.Node, eventType, reason, messageFmt string, args ...interface{}) {
+	if m.eventRecorder == nil || m.Opts.DryRun {
+		return
+	}
+
+	m.eventRecorder.Eventf(node, eventType, reason, messageFmt, args...)
+}
+
+// recordPoolMembershipEvents creates events for pools which were applied to the node before but are no longer matching
+// (retained pools are still matching but not applied, eg. gated or broken pools)
+func (m *KubePoolManager) recordPoolMembershipEvents(node *corev1.Node, previousPools, appliedPools, retainedPools []string) {
+	for _, poolName := range previousPools {
+		if config.ContainsKey(appliedPools, poolName) || config.ContainsKey(retainedPools, poolName) {
+			continue
+		}
+
+		m.recordNodeEvent(node, corev1.EventTypeNormal, EventReasonPoolNotMatching, "node is no longer matching pool %s", poolName)
+	}
+}
+
+func joinPoolNames(poolNameList []string) string {
+	if len(poolNameList) == 0 {
+		return "<none>"
+	}
+	return strings.Join(poolNameList, ", ")
+}
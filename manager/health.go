@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	HealthStatusOk       = "ok"
+	HealthStatusStandby  = "standby"
+	HealthStatusNotReady = "not ready"
+	HealthStatusFailed   = "failed"
+)
+
+type (
+	// HealthStatus is the response of /healthz and /readyz
+	HealthStatus struct {
+		Status string         `json:"status"`
+		Checks []*HealthCheck `json:"checks"`
+	}
+
+	HealthCheck struct {
+		Name    string `json:"name"`
+		Ok      bool   `json:"ok"`
+		Message string `json:"message"`
+	}
+)
+
+func (s *HealthStatus) addCheck(name string, ok bool, message string, args ...interface{}) {
+	s.Checks = append(s.Checks, &HealthCheck{Name: name, Ok: ok, Message: fmt.Sprintf(message, args...)})
+}
+
+func (s *HealthStatus) isOk() bool {
+	for _, check := range s.Checks {
+		if !check.Ok {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterHealthHandlers registers the liveness (/healthz) and readiness (/readyz) probes,
+// non-leader replicas report the standby status (healthy and ready)
+func (m *KubePoolManager) RegisterHealthHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		m.writeHealthStatus(w, m.Liveness())
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		m.writeHealthStatus(w, m.Readiness())
+	})
+}
+
+func (m *KubePoolManager) writeHealthStatus(w http.ResponseWriter, status *HealthStatus) {
+	statusCode := http.StatusOK
+	if status.Status != HealthStatusOk && status.Status != HealthStatusStandby {
+		statusCode = http.StatusServiceUnavailable
+	}
+	m.writeApiResponse(w, statusCode, status)
+}
+
+// Readiness checks if the configuration is loaded, the initial sync of all nodes is done and the node watch is connected
+func (m *KubePoolManager) Readiness() *HealthStatus {
+	status := &HealthStatus{Status: HealthStatusOk, Checks: []*HealthCheck{}}
+
+	if conf := m.GetConfig(); conf != nil {
+		status.addCheck("config", true, "configuration loaded (%v pools)", len(conf.Pools))
+	} else {
+		status.addCheck("config", false, "configuration not loaded")
+	}
+
+	if !m.isLeader.Load() {
+		status.addCheck("leader", true, "waiting for leader election")
+		status.Status = HealthStatusStandby
+		return status
+	}
+	status.addCheck("leader", true, "leader")
+
+	if m.initialSyncDone.Load() {
+		status.addCheck("initialSync", true, "initial sync of all nodes done")
+	} else {
+		status.addCheck("initialSync", false, "initial sync of all nodes not finished")
+	}
+
+	if m.nodeWatchConnected.Load() {
+		status.addCheck("nodeWatch", true, "node watch connected")
+	} else {
+		status.addCheck("nodeWatch", false, "node watch not connected")
+	}
+
+	if !status.isOk() {
+		status.Status = HealthStatusNotReady
+	}
+
+	return status
+}
+
+// Liveness checks if the reconcile loop made progress within the liveness timeout
+// (an idle reconcile loop without pending nodes is healthy)
+func (m *KubePoolManager) Liveness() *HealthStatus {
+	status := &HealthStatus{Status: HealthStatusOk, Checks: []*HealthCheck{}}
+
+	if !m.isLeader.Load() {
+		status.addCheck("leader", true, "waiting for leader election")
+		status.Status = HealthStatusStandby
+		return status
+	}
+
+	lastProgress := time.Unix(0, m.lastProgress.Load())
+	pending := !m.initialSyncDone.Load() || m.nodeQueue.Len() > 0
+	switch {
+	case !pending:
+		status.addCheck("reconcile", true, "no pending nodes")
+	case m.Opts.Health.LivenessTimeout <= 0 || time.Since(lastProgress) <= m.Opts.Health.LivenessTimeout:
+		status.addCheck("reconcile", true, "last progress %v ago", time.Since(lastProgress).Round(time.Second))
+	default:
+		status.addCheck("reconcile", false, "no progress for %v with pending nodes", time.Since(lastProgress).Round(time.Second))
+		status.Status = HealthStatusFailed
+	}
+
+	return status
+}
+
+// recordProgress marks progress of the reconcile loop (used for liveness)
+func (m *KubePoolManager) recordProgress() {
+	m.lastProgress.Store(time.Now().UnixNano())
+}
+
+// startInitialSync tracks the nodes which have to be processed before the initial sync is done
+func (m *KubePoolManager) startInitialSync(nodeNameList []string) {
+	m.nodePatchStatusLock.Lock()
+	defer m.nodePatchStatusLock.Unlock()
+
+	if m.initialSyncDone.Load() || m.initialSyncPending != nil {
+		return
+	}
+
+	m.initialSyncPending = map[string]bool{}
+	for _, nodeName := range nodeNameList {
+		m.initialSyncPending[nodeName] = true
+	}
+
+	if len(m.initialSyncPending) == 0 {
+		m.initialSyncDone.Store(true)
+	}
+}
+
+// finishInitialSync marks the node as processed for the initial sync
+func (m *KubePoolManager) finishInitialSync(nodeName string) {
+	if m.initialSyncDone.Load() {
+		return
+	}
+
+	m.nodePatchStatusLock.Lock()
+	defer m.nodePatchStatusLock.Unlock()
+
+	if m.initialSyncPending == nil {
+		return
+	}
+
+	delete(m.initialSyncPending, nodeName)
+	if len(m.initialSyncPending) == 0 {
+		m.Logger.Info("initial sync of all nodes done")
+		m.initialSyncDone.Store(true)
+	}
+}
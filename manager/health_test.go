@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func healthStatusCode(t *testing.T, m *KubePoolManager, path string) int {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	m.RegisterHealthHandlers(mux)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder.Code
+}
+
+func Test_Readiness(t *testing.T) {
+	m, _ := newTestManager(t, testPoolConfig)
+
+	// non-leader replicas are on standby
+	if status := m.Readiness(); status.Status != HealthStatusStandby {
+		t.Errorf("Expected status %v, got %v", HealthStatusStandby, status.Status)
+	}
+	if code := healthStatusCode(t, m, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected status code 200 on standby, got %v", code)
+	}
+
+	// leader without initial sync and node watch
+	m.isLeader.Store(true)
+	if status := m.Readiness(); status.Status != HealthStatusNotReady {
+		t.Errorf("Expected status %v, got %v", HealthStatusNotReady, status.Status)
+	}
+	if code := healthStatusCode(t, m, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code 503, got %v", code)
+	}
+
+	// initial sync is done after all nodes are processed
+	m.startInitialSync([]string{"node-1", "node-2"})
+	m.finishInitialSync("node-1")
+	if m.initialSyncDone.Load() {
+		t.Error("Expected initial sync to be pending")
+	}
+	m.finishInitialSync("node-2")
+	if !m.initialSyncDone.Load() {
+		t.Error("Expected initial sync to be done")
+	}
+	if status := m.Readiness(); status.Status != HealthStatusNotReady {
+		t.Errorf("Expected status %v without node watch, got %v", HealthStatusNotReady, status.Status)
+	}
+
+	m.nodeWatchConnected.Store(true)
+	if status := m.Readiness(); status.Status != HealthStatusOk {
+		t.Errorf("Expected status %v, got %v", HealthStatusOk, status.Status)
+	}
+
+	// node watch disconnected
+	m.nodeWatchConnected.Store(false)
+	if status := m.Readiness(); status.Status != HealthStatusNotReady {
+		t.Errorf("Expected status %v after node watch disconnect, got %v", HealthStatusNotReady, status.Status)
+	}
+}
+
+func Test_InitialSyncWithoutNodes(t *testing.T) {
+	m, _ := newTestManager(t, testPoolConfig)
+
+	m.startInitialSync([]string{})
+	if !m.initialSyncDone.Load() {
+		t.Error("Expected initial sync to be done without nodes")
+	}
+}
+
+func Test_Liveness(t *testing.T) {
+	m, _ := newTestManager(t, testPoolConfig)
+	m.Opts.Health.LivenessTimeout = time.Minute
+
+	// non-leader replicas are on standby
+	if status := m.Liveness(); status.Status != HealthStatusStandby {
+		t.Errorf("Expected status %v, got %v", HealthStatusStandby, status.Status)
+	}
+
+	// pending initial sync within the liveness timeout
+	m.isLeader.Store(true)
+	m.recordProgress()
+	if status := m.Liveness(); status.Status != HealthStatusOk {
+		t.Errorf("Expected status %v, got %v", HealthStatusOk, status.Status)
+	}
+
+	// pending initial sync without progress
+	m.lastProgress.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if status := m.Liveness(); status.Status != HealthStatusFailed {
+		t.Errorf("Expected status %v, got %v", HealthStatusFailed, status.Status)
+	}
+	if code := healthStatusCode(t, m, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code 503, got %v", code)
+	}
+
+	// idle reconcile loop is healthy
+	m.initialSyncDone.Store(true)
+	if status := m.Liveness(); status.Status != HealthStatusOk {
+		t.Errorf("Expected status %v without pending nodes, got %v", HealthStatusOk, status.Status)
+	}
+
+	// queued nodes without progress
+	m.nodeQueue.Add("node-1")
+	if status := m.Liveness(); status.Status != HealthStatusFailed {
+		t.Errorf("Expected status %v with queued nodes, got %v", HealthStatusFailed, status.Status)
+	}
+
+	// disabled liveness timeout
+	m.Opts.Health.LivenessTimeout = 0
+	if status := m.Liveness(); status.Status != HealthStatusOk {
+		t.Errorf("Expected status %v with disabled timeout, got %v", HealthStatusOk, status.Status)
+	}
+}
@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// newLeaderElector creates the Lease based leader election, the lease is released when the context is cancelled
+func (m *KubePoolManager) newLeaderElector(onStartedLeading func(ctx context.Context)) (*leaderelection.LeaderElector, error) {
+	namespace, err := m.leaseNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := m.leaseIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      m.Opts.Lease.Name,
+			Namespace: namespace,
+		},
+		Client: m.k8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            m.Opts.Lease.Name,
+		LeaseDuration:   m.Opts.Lease.LeaseDuration,
+		RenewDeadline:   m.Opts.Lease.RenewDeadline,
+		RetryPeriod:     m.Opts.Lease.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				m.Logger.Infof("acquired lease %v/%v as %v", namespace, m.Opts.Lease.Name, identity)
+				m.prometheus.leader.Set(1)
+				onStartedLeading(ctx)
+			},
+			OnStoppedLeading: func() {
+				m.isLeader.Store(false)
+				m.prometheus.leader.Set(0)
+
+				if m.ctx.Err() != nil {
+					m.Logger.Infof("released lease %v/%v", namespace, m.Opts.Lease.Name)
+					return
+				}
+
+				// informers and workers can't be stopped safely, restart and wait for the lease again
+				m.Logger.Fatalf("lost lease %v/%v, restarting", namespace, m.Opts.Lease.Name)
+			},
+			OnNewLeader: func(leaderIdentity string) {
+				if leaderIdentity != identity {
+					m.Logger.Infof("current leader is %v, waiting for lease", leaderIdentity)
+				}
+			},
+		},
+	})
+}
+
+// leaseNamespace returns the namespace of the lease (namespace of the pod)
+func (m *KubePoolManager) leaseNamespace() (string, error) {
+	if m.Opts.Instance.Namespace != nil && *m.Opts.Instance.Namespace != "" {
+		return *m.Opts.Instance.Namespace, nil
+	}
+
+	/* #nosec */
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace, nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to detect namespace for lease, please set --instance.namespace")
+}
+
+// leaseIdentity returns the identity of the lease holder (name of the pod)
+func (m *KubePoolManager) leaseIdentity() (string, error) {
+	if m.Opts.Instance.Pod != nil && *m.Opts.Instance.Pod != "" {
+		return *m.Opts.Instance.Pod, nil
+	}
+
+	return os.Hostname()
+}
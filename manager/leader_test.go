@@ -0,0 +1,111 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testLeaseNamespace = "kube-system"
+	testLeaseIdentity  = "kube-pool-manager-0"
+)
+
+// enableTestLease enables the leader election with short durations
+func enableTestLease(m *KubePoolManager) {
+	namespace := testLeaseNamespace
+	identity := testLeaseIdentity
+
+	m.Opts.Instance.Namespace = &namespace
+	m.Opts.Instance.Pod = &identity
+	m.Opts.Lease.Enabled = true
+	m.Opts.Lease.Name = "kube-pool-manager-leader"
+	m.Opts.Lease.LeaseDuration = 2 * time.Second
+	m.Opts.Lease.RenewDeadline = time.Second
+	m.Opts.Lease.RetryPeriod = 100 * time.Millisecond
+}
+
+// waitForLeader waits until the manager acquired the lease, fails if the lease is not acquired within the timeout
+func waitForLeader(t *testing.T, m *KubePoolManager) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.isLeader.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected lease to be acquired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func leaseHolder(t *testing.T, client *fake.Clientset, m *KubePoolManager) string {
+	t.Helper()
+
+	lease, err := client.CoordinationV1().Leases(testLeaseNamespace).Get(context.Background(), m.Opts.Lease.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func Test_LeaseNamespace(t *testing.T) {
+	m := &KubePoolManager{}
+
+	namespace := testLeaseNamespace
+	m.Opts.Instance.Namespace = &namespace
+	if value, err := m.leaseNamespace(); err != nil || value != testLeaseNamespace {
+		t.Errorf("Expected namespace %v, got %v (%v)", testLeaseNamespace, value, err)
+	}
+
+	identity := testLeaseIdentity
+	m.Opts.Instance.Pod = &identity
+	if value, err := m.leaseIdentity(); err != nil || value != testLeaseIdentity {
+		t.Errorf("Expected identity %v, got %v (%v)", testLeaseIdentity, value, err)
+	}
+}
+
+func Test_LeaseRelease(t *testing.T) {
+	m, client := newTestManager(t, testPoolConfig, buildNode("node-1"))
+	enableTestLease(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.ctx = ctx
+
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForLeader(t, m)
+
+	if holder := leaseHolder(t, client, m); holder != testLeaseIdentity {
+		t.Errorf("Expected lease holder %v, got %v", testLeaseIdentity, holder)
+	}
+
+	// lease is kept until Shutdown
+	cancel()
+	if holder := leaseHolder(t, client, m); holder != testLeaseIdentity {
+		t.Errorf("Expected lease to be held until shutdown, got holder %v", holder)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	m.Shutdown(shutdownCtx)
+
+	select {
+	case <-m.electionDone:
+	default:
+		t.Error("Expected leader election to be stopped")
+	}
+	if holder := leaseHolder(t, client, m); holder != "" {
+		t.Errorf("Expected lease to be released, got holder %v", holder)
+	}
+	if m.isLeader.Load() {
+		t.Error("Expected manager not to be leader after shutdown")
+	}
+}
@@ -3,19 +3,31 @@ package manager
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/operator-framework/operator-lib/leader"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 
 	"github.com/go-logr/zapr"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -26,48 +38,103 @@ import (
 
 type (
 	KubePoolManager struct {
-		Opts   config.Opts
-		Config config.Config
+		Opts config.Opts
 
 		Logger *zap.SugaredLogger
 
-		ctx       context.Context
-		k8sClient *kubernetes.Clientset
-
-		nodePatchStatus map[string]bool
+		poolConfig atomic.Pointer[config.Config]
+		fileConfig atomic.Pointer[config.Config]
+		nodePools  atomic.Pointer[[]*config.NodePoolSpec]
+		configLock sync.Mutex
+
+		ctx            context.Context
+		workCtx        context.Context
+		cancelWork     context.CancelFunc
+		cancelElection context.CancelFunc
+		electionDone   chan struct{}
+		workers        sync.WaitGroup
+
+		k8sClient     kubernetes.Interface
+		dynamicClient dynamic.Interface
+
+		// nodeLister is replaced when the node watch is restarted, while the api handlers are reading it
+		nodeLister atomic.Pointer[listersv1.NodeLister]
+		nodeQueue  workqueue.TypedRateLimitingInterface[string]
+
+		eventRecorder record.EventRecorder
+
+		nodePatchStatus     map[string]bool
+		nodePoolMembership  map[string][]string
+		nodeApplyStatus     map[string]*nodeApplyStatus
+		nodePatchStatusLock sync.RWMutex
+		nodeWatchReady      atomic.Bool
+		nodeWatchConnected  atomic.Bool
+		lastFullReconcile   atomic.Int64
+
+		isLeader           atomic.Bool
+		initialSyncPending map[string]bool
+		initialSyncDone    atomic.Bool
+		lastProgress       atomic.Int64
+
+		nodePoolLister  cache.GenericLister
+		nodePoolErrors  map[string]string
+		poolLastApplied map[string]time.Time
+		poolApplyErrors map[string]map[string]string
+		poolStatusLock  sync.RWMutex
+
+		// metricsRegistry is the registry of the metrics (defaults to the global prometheus registry)
+		metricsRegistry prometheus.Registerer
 
 		prometheus struct {
 			nodePoolStatus *prometheus.GaugeVec
 			nodeApplied    *prometheus.GaugeVec
+
+			nodePatched      prometheus.Counter
+			nodePatchSkipped prometheus.Counter
+
+			nodePatchAttempts *prometheus.CounterVec
+			nodePatchSuccess  *prometheus.CounterVec
+			nodePatchFailures *prometheus.CounterVec
+			nodePatchDuration prometheus.Histogram
+
+			nodeWatchRestarts prometheus.Counter
+			nodeWatchErrors   prometheus.Counter
+
+			poolNodes        *prometheus.GaugeVec
+			poolFailedNodes  *prometheus.GaugeVec
+			fullReconcileAge prometheus.GaugeFunc
+			configInfo       *prometheus.GaugeVec
+
+			leader prometheus.Gauge
+
+			configReload       *prometheus.CounterVec
+			configReloadStatus prometheus.Gauge
+			configReloadTime   prometheus.Gauge
 		}
 	}
 )
 
-func (m *KubePoolManager) Init() {
-	m.ctx = context.Background()
-	m.nodePatchStatus = map[string]bool{}
+// Init initializes the manager, the context is the root context of the manager (cancelled on shutdown)
+func (m *KubePoolManager) Init(ctx context.Context) {
+	m.init(ctx)
 	m.initK8s()
+	m.initEvents()
 	m.initPrometheus()
 }
 
-func (r *KubePoolManager) initPrometheus() {
-	r.prometheus.nodePoolStatus = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "poolmanager_node_pool_status",
-			Help: "kube-pool-manager node pool config status",
-		},
-		[]string{"nodeName", "pool"},
-	)
-	prometheus.MustRegister(r.prometheus.nodePoolStatus)
-
-	r.prometheus.nodeApplied = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "poolmanager_node_applied",
-			Help: "kube-pool-manager node applied time",
-		},
-		[]string{"nodeName"},
+// init initializes the state of the manager
+func (m *KubePoolManager) init(ctx context.Context) {
+	m.ctx = ctx
+	m.nodePatchStatus = map[string]bool{}
+	m.nodePoolMembership = map[string][]string{}
+	m.nodeApplyStatus = map[string]*nodeApplyStatus{}
+	m.nodePoolErrors = map[string]string{}
+	m.poolLastApplied = map[string]time.Time{}
+	m.poolApplyErrors = map[string]map[string]string{}
+	m.nodeQueue = workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.DefaultTypedControllerRateLimiter[string](),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "nodes"},
 	)
-	prometheus.MustRegister(r.prometheus.nodeApplied)
 }
 
 func (r *KubePoolManager) initK8s() {
@@ -93,163 +160,458 @@ func (r *KubePoolManager) initK8s() {
 		panic(err.Error())
 	}
 
+	r.dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		panic(err.Error())
+	}
+
 	log.SetLogger(zapr.NewLogger(r.Logger.Desugar()))
 }
 
-func (m *KubePoolManager) Start() {
-	go func() {
-		m.leaderElect()
+// Start starts the config watch and the node reconcile loop (after the leader election if enabled),
+// the watches stop when the context is cancelled, in-flight node patches and the lease are handled by Shutdown
+func (m *KubePoolManager) Start(ctx context.Context) error {
+	if m.Opts.K8s.Workers < 1 {
+		return fmt.Errorf("at least one node worker is required, got %v", m.Opts.K8s.Workers)
+	}
 
-		m.Logger.Info("initial node pool apply")
-		m.startupApply()
+	if m.Opts.StartupTaint.Enabled {
+		if err := config.ValidateTaint(m.Opts.StartupTaint.Taint); err != nil {
+			return fmt.Errorf("invalid startup taint: %w", err)
+		}
+		if fileConfig := m.fileConfig.Load(); fileConfig == nil || fileConfig.ReadinessGate == nil {
+			m.Logger.Infof("startup taint enabled, applying pools as soon as nodes are registered (no global readinessGate configured)")
+		}
+	}
 
-		for {
-			m.Logger.Info("(re)starting node watch")
-			if err := m.startNodeWatch(); err != nil {
-				m.Logger.Warnf("node watcher stopped: %v", err)
-			}
+	// in-flight node patches are finished after the root context is cancelled (until the grace period of Shutdown)
+	m.workCtx, m.cancelWork = context.WithCancel(context.WithoutCancel(ctx))
 
-			if m.Opts.K8s.ReapplyOnWatchTimeout {
-				m.Logger.Info("reapply node pool settings")
-				m.startupApply()
-			}
-		}
+	m.startConfigWatch()
+
+	if !m.Opts.Lease.Enabled {
+		go m.run(ctx)
+		return nil
+	}
+
+	leaderElector, err := m.newLeaderElector(func(_ context.Context) {
+		// losing the lease is fatal, the reconcile loop is stopped by the root context only
+		m.run(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to setup leader election: %w", err)
+	}
+
+	// the lease is released by Shutdown after in-flight node patches are finished
+	var electionCtx context.Context
+	electionCtx, m.cancelElection = context.WithCancel(context.WithoutCancel(ctx))
+	m.electionDone = make(chan struct{})
+
+	m.Logger.Infof("trying to become leader (lease %v)", m.Opts.Lease.Name)
+	go func() {
+		defer close(m.electionDone)
+		leaderElector.Run(electionCtx)
 	}()
+
+	return nil
 }
 
-func (m *KubePoolManager) leaderElect() {
-	if m.Opts.Lease.Enabled {
-		m.Logger.Info("trying to become leader")
-		if m.Opts.Instance.Pod != nil && os.Getenv("POD_NAME") == "" {
-			err := os.Setenv("POD_NAME", *m.Opts.Instance.Pod)
-			if err != nil {
-				m.Logger.Panic(err)
-			}
+// run starts the NodePool and node watch, failed watches are restarted with backoff
+func (m *KubePoolManager) run(ctx context.Context) {
+	m.recordProgress()
+	m.isLeader.Store(true)
+	defer m.nodeQueue.ShutDown()
+
+	m.retryWithBackoff(ctx, "NodePool watch", m.startNodePoolWatch)
+	m.retryWithBackoff(ctx, "node watch", m.startNodeWatch)
+}
+
+// retryWithBackoff runs the function until it succeeds or the context is cancelled, errors are retried with
+// exponential backoff
+func (m *KubePoolManager) retryWithBackoff(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	backoff := wait.Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      5 * time.Minute,
+	}
+
+	for {
+		err := fn(ctx)
+		if err == nil || ctx.Err() != nil {
+			return
 		}
 
-		time.Sleep(15 * time.Second)
-		err := leader.Become(m.ctx, m.Opts.Lease.Name)
-		if err != nil {
-			m.Logger.Error(err, "Failed to retry for leader lock")
-			os.Exit(1)
+		delay := backoff.Step()
+		m.Logger.Errorf("%v failed, retrying in %v: %v", name, delay.Round(time.Second), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
 		}
-		m.Logger.Info("aquired leader lock, continue")
 	}
 }
 
-func (m *KubePoolManager) startupApply() {
-	listOpts := metav1.ListOptions{}
-	nodeList, err := m.k8sClient.CoreV1().Nodes().List(m.ctx, listOpts)
-	if err != nil {
-		m.Logger.Panic(err)
+// Shutdown waits until the node workers finished their in-flight node patches (in-flight patches are abandoned
+// when the context expires) and releases the lease, has to be called after the root context was cancelled
+func (m *KubePoolManager) Shutdown(ctx context.Context) {
+	workersDone := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+		m.Logger.Info("node workers stopped")
+	case <-ctx.Done():
+		m.Logger.Warn("shutdown grace period expired, abandoning in-flight node patches")
+	}
+	if m.cancelWork != nil {
+		m.cancelWork()
 	}
 
-	m.nodePatchStatus = map[string]bool{}
-	for _, row := range nodeList.Items {
-		node := row
-		m.nodePatchStatus[node.Name] = true
-		m.applyNode(&node)
+	if m.cancelElection != nil {
+		m.cancelElection()
+		select {
+		case <-m.electionDone:
+		case <-time.After(m.Opts.Lease.RenewDeadline):
+			m.Logger.Warn("timeout while releasing lease")
+		}
 	}
 }
 
-func (m *KubePoolManager) startNodeWatch() error {
-	timeout := int64(m.Opts.K8s.WatchTimeout.Seconds())
-	watchOpts := metav1.ListOptions{
-		LabelSelector:  m.Opts.K8s.NodeLabelSelector,
-		TimeoutSeconds: &timeout,
-		Watch:          true,
+// startupApply enqueues all known nodes for (re)applying their configuration without waiting for node readiness
+func (m *KubePoolManager) startupApply(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	nodeWatcher, err := m.k8sClient.CoreV1().Nodes().Watch(m.ctx, watchOpts)
+
+	nodeList, err := m.getNodeLister().List(labels.Everything())
 	if err != nil {
-		m.Logger.Panic(err)
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	m.nodePatchStatusLock.Lock()
+	m.nodePatchStatus = map[string]bool{}
+	for _, node := range nodeList {
+		m.nodePatchStatus[node.Name] = false
 	}
-	defer nodeWatcher.Stop()
+	m.nodePatchStatusLock.Unlock()
 
-	for res := range nodeWatcher.ResultChan() {
-		switch res.Type {
-		case watch.Modified:
-			if node, ok := res.Object.(*corev1.Node); ok {
+	nodeNameList := []string{}
+	for _, node := range nodeList {
+		nodeNameList = append(nodeNameList, node.Name)
+	}
+	m.startInitialSync(nodeNameList)
+
+	for _, node := range nodeList {
+		m.nodeQueue.Add(node.Name)
+	}
+	m.lastFullReconcile.Store(time.Now().UnixNano())
+
+	return nil
+}
+
+// startNodeWatch starts the node informer and the node workers, blocks until the context is cancelled
+func (m *KubePoolManager) startNodeWatch(ctx context.Context) error {
+	informerFactory := informers.NewSharedInformerFactory(m.k8sClient, 0)
+	informerFactory.InformerFor(&corev1.Node{}, m.newNodeInformer)
+	nodeInformer := informerFactory.Core().V1().Nodes()
+	nodeLister := nodeInformer.Lister()
+	m.nodeLister.Store(&nodeLister)
+
+	if err := nodeInformer.Informer().SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		m.nodeWatchConnected.Store(false)
+		m.prometheus.nodeWatchErrors.Inc()
+		cache.DefaultWatchErrorHandler(r, err)
+	}); err != nil {
+		return err
+	}
+
+	_, err := nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				m.nodePatchStatusLock.Lock()
 				if _, exists := m.nodePatchStatus[node.Name]; !exists {
 					m.nodePatchStatus[node.Name] = false
 				}
-
-				if !m.nodePatchStatus[node.Name] && m.checkNodeCondition(node) {
-					m.applyNode(node)
-					m.nodePatchStatus[node.Name] = true
-				}
+				m.nodePatchStatusLock.Unlock()
+				m.nodeQueue.Add(node.Name)
 			}
-		case watch.Deleted:
-			if node, ok := res.Object.(*corev1.Node); ok {
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if node, ok := newObj.(*corev1.Node); ok {
+				m.nodeQueue.Add(node.Name)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			if node, ok := obj.(*corev1.Node); ok {
+				m.nodePatchStatusLock.Lock()
 				delete(m.nodePatchStatus, node.Name)
+				m.nodePatchStatusLock.Unlock()
+				m.removeNodePoolMembership(node.Name)
+				m.deleteNodeMetrics(node.Name)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	m.Logger.Info("starting node informer")
+	informerFactory.Start(ctx.Done())
+	defer informerFactory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), nodeInformer.Informer().HasSynced) {
+		return fmt.Errorf("failed to sync node informer cache")
+	}
+
+	m.Logger.Info("initial node pool apply")
+	if err := m.startupApply(ctx); err != nil {
+		return err
+	}
+	m.nodeWatchReady.Store(true)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	m.Logger.Infof("starting %v node workers", m.Opts.K8s.Workers)
+	for i := 0; i < m.Opts.K8s.Workers; i++ {
+		m.workers.Add(1)
+		go func() {
+			defer m.workers.Done()
+			m.runNodeWorker(m.workCtx)
+		}()
+	}
+
+	reapplyTicker := time.NewTicker(m.Opts.K8s.WatchTimeout)
+	defer reapplyTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.Logger.Info("stopping node watch")
+			return ctx.Err()
+		case <-reapplyTicker.C:
+			if m.Opts.K8s.ReapplyOnWatchTimeout {
+				m.Logger.Info("reapply node pool settings")
+				if err := m.startupApply(ctx); err != nil {
+					m.Logger.Errorf("failed to reapply node pool settings: %v", err)
+				}
 			}
-		case watch.Error:
-			m.Logger.Errorf("go watch error event %v", res.Object)
 		}
 	}
+}
 
-	return fmt.Errorf("terminated")
+// newNodeInformer creates the node informer, restarts of the node watch are counted in metrics
+func (m *KubePoolManager) newNodeInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	watchStarted := atomic.Bool{}
+
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				opts.LabelSelector = m.Opts.K8s.NodeLabelSelector
+				nodeList, err := client.CoreV1().Nodes().List(m.ctx, opts)
+				m.nodeWatchConnected.Store(err == nil)
+				return nodeList, err
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				if watchStarted.Swap(true) {
+					m.prometheus.nodeWatchRestarts.Inc()
+				}
+				opts.LabelSelector = m.Opts.K8s.NodeLabelSelector
+				nodeWatch, err := client.CoreV1().Nodes().Watch(m.ctx, opts)
+				m.nodeWatchConnected.Store(err == nil)
+				return nodeWatch, err
+			},
+		},
+		&corev1.Node{},
+		resyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
 }
 
-func (m *KubePoolManager) checkNodeCondition(node *corev1.Node) bool {
-	for _, condition := range node.Status.Conditions {
-		if stringCompare(string(condition.Type), "ready") && stringCompare(condition.Reason, "kubeletready") && stringCompare(string(condition.Status), "true") {
-			return true
-		}
+// runNodeWorker processes nodes until the node queue is shut down
+func (m *KubePoolManager) runNodeWorker(ctx context.Context) {
+	for m.processNextNode(ctx) {
+	}
+}
+
+// getNodeLister returns the lister of the current node watch
+func (m *KubePoolManager) getNodeLister() listersv1.NodeLister {
+	if nodeLister := m.nodeLister.Load(); nodeLister != nil {
+		return *nodeLister
+	}
+	return nil
+}
+
+func (m *KubePoolManager) processNextNode(ctx context.Context) bool {
+	nodeName, shutdown := m.nodeQueue.Get()
+	if shutdown {
+		return false
 	}
+	defer m.nodeQueue.Done(nodeName)
 
-	return false
+	// queued nodes are abandoned on shutdown
+	if m.nodeQueue.ShuttingDown() {
+		return false
+	}
+	defer m.finishInitialSync(nodeName)
+	defer m.recordProgress()
+
+	if err := m.syncNode(ctx, nodeName); err != nil {
+		m.Logger.With(zap.String("node", nodeName)).Errorf("failed to apply configuration to node \"%s\" (retry #%v): %v", nodeName, m.nodeQueue.NumRequeues(nodeName)+1, err)
+		m.nodeQueue.AddRateLimited(nodeName)
+		return true
+	}
+
+	m.nodeQueue.Forget(nodeName)
+	return true
 }
 
-func (m *KubePoolManager) applyNode(node *corev1.Node) {
-	contextLogger := m.Logger.With(zap.String("node", node.Name))
+func (m *KubePoolManager) syncNode(ctx context.Context, nodeName string) error {
+	node, err := m.getNodeLister().Get(nodeName)
+	if k8serrors.IsNotFound(err) {
+		// node was deleted
+		return nil
+	} else if err != nil {
+		return err
+	}
 
-	nodePatchSets := k8s.NewJsonPatchSet()
-	poolNameList := []string{}
+	m.nodePatchStatusLock.RLock()
+	applied := m.nodePatchStatus[node.Name]
+	m.nodePatchStatusLock.RUnlock()
 
-	for _, poolConfig := range m.Config.Pools {
-		m.prometheus.nodePoolStatus.WithLabelValues(node.Name, poolConfig.Name).Set(0)
-		poolLogger := contextLogger.With(zap.String("pool", poolConfig.Name))
-		matching, err := poolConfig.IsMatchingNode(poolLogger, node)
+	// nodes with startup taint are configured immediately (and again if the taint is added later)
+	startupTaint := false
+	if m.Opts.StartupTaint.Enabled {
+		startupTaint, err = config.NodeHasTaint(node, m.Opts.StartupTaint.Taint)
 		if err != nil {
-			poolLogger.Panic(err)
+			return err
 		}
+	}
 
-		if matching {
-			poolLogger.Infof("adding configuration from pool \"%s\" to node \"%s\"", poolConfig.Name, node.Name)
+	if applied && !startupTaint {
+		return nil
+	}
+
+	completed, err := m.applyNode(ctx, node)
+	if err != nil {
+		return err
+	}
+
+	// pools waiting for their readiness gate are applied with the next node update
+	m.nodePatchStatusLock.Lock()
+	m.nodePatchStatus[node.Name] = completed
+	m.nodePatchStatusLock.Unlock()
+
+	return nil
+}
 
-			// create json patch
-			patchSet := poolConfig.CreateJsonPatchSet(node)
-			nodePatchSets.AddSet(patchSet)
-			poolNameList = append(poolNameList, poolConfig.Name)
-		} else {
-			poolLogger.Debugf("Node NOT matches pool \"%s\"", poolConfig.Name)
+// applyNode applies the configuration of all matching pools with fulfilled readiness gate to the node,
+// returns false if pools are still waiting for their readiness gate
+func (m *KubePoolManager) applyNode(ctx context.Context, node *corev1.Node) (bool, error) {
+	contextLogger := m.Logger.With(zap.String("node", node.Name))
+
+	poolConfig := m.GetConfig()
+	for _, pool := range poolConfig.Pools {
+		m.prometheus.nodePoolStatus.WithLabelValues(node.Name, pool.Name).Set(0)
+	}
+
+	// broken pools are skipped, all other pools are still applied
+	nodePatchSets, poolNameList, gatedPoolNameList, err := poolConfig.CreateJsonPatchSet(contextLogger, node)
+	poolErrors, _ := config.AsPoolErrors(err)
+	if err != nil && poolErrors == nil {
+		return false, err
+	}
+
+	// nodes with gated or broken pools are evaluated again with the next node update
+	completed := len(gatedPoolNameList) == 0 && len(poolErrors) == 0
+
+	// pools applied before are persisted in the managed keys annotation (also available after a restart)
+	previousPoolNameList := []string{}
+	if managedKeys, err := config.ParseNodeManagedKeys(node); err == nil {
+		previousPoolNameList = managedKeys.Pools
+	}
+
+	// remove startup taint with the same patch after all pools are applied, so the node stays unschedulable if the patch fails
+	if m.Opts.StartupTaint.Enabled && completed {
+		if err := config.AddTaintRemovalPatch(nodePatchSets, node, m.Opts.StartupTaint.Taint); err != nil {
+			return false, err
 		}
 	}
 
+	for _, poolError := range poolErrors {
+		m.recordNodeEvent(node, corev1.EventTypeWarning, EventReasonPoolFailed, "failed to evaluate pool %s: %v", poolError.Pool, poolError.Err)
+	}
+
+	appliedPatchSet, err := m.applyNodePatchSet(ctx, contextLogger, node, nodePatchSets)
+	m.recordPoolApply(node.Name, poolNameList, err, poolErrors)
+	if err != nil || appliedPatchSet.Len() > 0 {
+		m.recordPatchMetrics(poolNameList, err)
+	}
+	if err != nil {
+		m.recordNodeEvent(node, corev1.EventTypeWarning, EventReasonPatchFailed, "failed to apply pools %s: %v", joinPoolNames(poolNameList), err)
+		return false, err
+	}
+
+	if appliedPatchSet.Len() > 0 {
+		m.recordNodeEvent(node, corev1.EventTypeNormal, EventReasonPoolsApplied, "applied pools %s: %s", joinPoolNames(poolNameList), appliedPatchSet.Summary())
+	}
+	m.recordPoolMembershipEvents(node, previousPoolNameList, poolNameList, append(gatedPoolNameList, poolErrors.Pools()...))
+
+	// metrics
+	for _, poolName := range poolNameList {
+		m.prometheus.nodePoolStatus.WithLabelValues(node.Name, poolName).Set(1)
+		m.prometheus.nodeApplied.WithLabelValues(node.Name).SetToCurrentTime()
+	}
+
+	return completed, nil
+}
+
+// applyNodePatchSet patches the node with all patches changing the node, returns the applied patches
+func (m *KubePoolManager) applyNodePatchSet(ctx context.Context, contextLogger *zap.SugaredLogger, node *corev1.Node, nodePatchSets *k8s.JsonPatchSet) (*k8s.JsonPatchSet, error) {
+	// only apply patches which are changing the node
+	nodePatchSets, err := nodePatchSets.Diff(node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff json patch: %w", err)
+	}
+
+	if nodePatchSets.Len() == 0 {
+		contextLogger.Infof("configuration of node \"%s\" is up to date, skipping patch", node.Name)
+		m.prometheus.nodePatchSkipped.Inc()
+		return nodePatchSets, nil
+	}
+
 	// apply patches
 	contextLogger.Infof("applying configuration to node \"%s\"", node.Name)
 
 	patchBytes, patchErr := nodePatchSets.Marshal()
 	if patchErr != nil {
-		contextLogger.Errorf("failed to create json patch: %v", patchErr)
-		return
+		return nil, fmt.Errorf("failed to create json patch: %w", patchErr)
 	}
 	contextLogger.Debugf("apply patchset: %v", string(patchBytes))
 
 	if !m.Opts.DryRun {
 		// patch node
-		_, k8sError := m.k8sClient.CoreV1().Nodes().Patch(m.ctx, node.Name, types.JSONPatchType, patchBytes, metav1.PatchOptions{})
+		patchStartTime := time.Now()
+		_, k8sError := m.k8sClient.CoreV1().Nodes().Patch(ctx, node.Name, types.JSONPatchType, patchBytes, metav1.PatchOptions{})
+		m.prometheus.nodePatchDuration.Observe(time.Since(patchStartTime).Seconds())
 		if k8sError != nil {
-			contextLogger.Errorf("failed to apply json patch: %v", k8sError)
-			return
+			return nil, fmt.Errorf("failed to apply json patch: %w", k8sError)
 		}
 	} else {
 		contextLogger.Infof("Not applying pool config, dry-run active")
 	}
 
-	// metrics
-	for _, poolName := range poolNameList {
-		m.prometheus.nodePoolStatus.WithLabelValues(node.Name, poolName).Set(1)
-		m.prometheus.nodeApplied.WithLabelValues(node.Name).SetToCurrentTime()
-	}
+	m.prometheus.nodePatched.Inc()
+
+	return nodePatchSets, nil
 }
@@ -0,0 +1,437 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+const testPoolConfig = `
+pools:
+  - pool: worker
+    selector:
+      - path: "{.metadata.labels.node\\.kubernetes\\.io/role}"
+        match: worker
+    node:
+      labels:
+        webdevops.io/pool: worker
+`
+
+var testLogger *zap.SugaredLogger
+
+func logger() *zap.SugaredLogger {
+	if testLogger == nil {
+		logger, err := zap.NewDevelopmentConfig().Build()
+		if err != nil {
+			panic(err)
+		}
+		testLogger = logger.Sugar()
+	}
+
+	return testLogger
+}
+
+func buildNode(name string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{"node.kubernetes.io/role": "worker"},
+			Annotations: map[string]string{"node.alpha.kubernetes.io/ttl": "0"},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady"},
+			},
+		},
+	}
+}
+
+// newTestManager creates a manager with a fake clientset and a synced node informer
+func newTestManager(t *testing.T, poolConfig string, nodes ...*corev1.Node) (*KubePoolManager, *fake.Clientset) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	objects := []runtime.Object{}
+	for _, node := range nodes {
+		objects = append(objects, node)
+	}
+	client := fake.NewSimpleClientset(objects...)
+
+	m := &KubePoolManager{
+		Logger:          logger(),
+		metricsRegistry: prometheus.NewRegistry(),
+	}
+	m.Opts.K8s.Workers = 1
+	m.init(ctx)
+	m.k8sClient = client
+	m.initPrometheus()
+
+	conf, err := config.Parse([]byte(poolConfig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := m.SetConfig(conf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	nodeInformer := informerFactory.Core().V1().Nodes()
+	nodeLister := nodeInformer.Lister()
+	m.nodeLister.Store(&nodeLister)
+	informerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), nodeInformer.Informer().HasSynced) {
+		t.Fatal("Expected node informer to be synced")
+	}
+
+	t.Cleanup(func() {
+		m.nodeQueue.ShutDown()
+		cancel()
+		informerFactory.Shutdown()
+	})
+
+	return m, client
+}
+
+// processNextNodeWithTimeout processes the next node of the queue, fails if no node is queued within the timeout
+func processNextNodeWithTimeout(t *testing.T, m *KubePoolManager) {
+	t.Helper()
+
+	done := make(chan bool)
+	go func() {
+		done <- m.processNextNode(context.Background())
+	}()
+
+	select {
+	case processed := <-done:
+		if !processed {
+			t.Fatal("Expected node to be processed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected queued node")
+	}
+}
+
+func patchActions(client *fake.Clientset) []k8stesting.Action {
+	actions := []k8stesting.Action{}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" && action.GetResource().Resource == "nodes" {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func Test_ProcessNextNode(t *testing.T) {
+	m, client := newTestManager(t, testPoolConfig, buildNode("node-1"))
+
+	m.nodeQueue.Add("node-1")
+	processNextNodeWithTimeout(t, m)
+
+	node, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if node.Labels["webdevops.io/pool"] != "worker" {
+		t.Errorf("Expected pool label to be set, got %v", node.Labels)
+	}
+	if _, exists := node.Annotations[config.NodeAnnotationManagedKeys]; !exists {
+		t.Error("Expected managed keys annotation to be set")
+	}
+
+	if !m.nodePatchStatus["node-1"] {
+		t.Error("Expected node to be marked as applied")
+	}
+	if m.nodeQueue.Len() != 0 || m.nodeQueue.NumRequeues("node-1") != 0 {
+		t.Error("Expected node to be removed from queue")
+	}
+
+	// applied nodes are not patched again
+	m.nodeQueue.Add("node-1")
+	processNextNodeWithTimeout(t, m)
+	if actions := patchActions(client); len(actions) != 1 {
+		t.Errorf("Expected one patch, got %v", len(actions))
+	}
+}
+
+func Test_ProcessNextNodeRetry(t *testing.T) {
+	m, client := newTestManager(t, testPoolConfig, buildNode("node-1"))
+
+	// first patch fails
+	failedPatches := 0
+	client.PrependReactor("patch", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failedPatches == 0 {
+			failedPatches++
+			return true, nil, errors.New("patch failed")
+		}
+		return false, nil, nil
+	})
+
+	m.nodeQueue.Add("node-1")
+	processNextNodeWithTimeout(t, m)
+
+	if m.nodePatchStatus["node-1"] {
+		t.Error("Expected node not to be marked as applied")
+	}
+	if m.nodeQueue.NumRequeues("node-1") != 1 {
+		t.Errorf("Expected node to be requeued, got %v requeues", m.nodeQueue.NumRequeues("node-1"))
+	}
+
+	// node is retried after the rate limit
+	processNextNodeWithTimeout(t, m)
+
+	if !m.nodePatchStatus["node-1"] {
+		t.Error("Expected node to be marked as applied after retry")
+	}
+	if m.nodeQueue.NumRequeues("node-1") != 0 {
+		t.Error("Expected retries to be reset")
+	}
+	if actions := patchActions(client); len(actions) != 2 {
+		t.Errorf("Expected two patches, got %v", len(actions))
+	}
+}
+
+func Test_SyncNodeDeleted(t *testing.T) {
+	m, client := newTestManager(t, testPoolConfig)
+
+	if err := m.syncNode(context.Background(), "deleted"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if actions := patchActions(client); len(actions) != 0 {
+		t.Errorf("Expected no patch for deleted node, got %v", actions)
+	}
+}
+
+func Test_NodeListerReplaced(t *testing.T) {
+	m, client := newTestManager(t, testPoolConfig, buildNode("node-1"))
+	m.nodeWatchReady.Store(true)
+
+	// node watch is restarted while the api is reading the nodes
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for num := 0; num < 20; num++ {
+			nodeLister := informers.NewSharedInformerFactory(client, 0).Core().V1().Nodes().Lister()
+			m.nodeLister.Store(&nodeLister)
+		}
+	}()
+
+	for num := 0; num < 20; num++ {
+		recorder := httptest.NewRecorder()
+		m.handleApiNodes(recorder, httptest.NewRequest(http.MethodGet, "/api/nodes", nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %v", recorder.Code)
+		}
+	}
+	<-done
+}
+
+func Test_PoolMembershipEvents(t *testing.T) {
+	node := buildNode("node-1")
+	node.Annotations[config.NodeAnnotationManagedKeys] = `{"pools":["removed","worker"]}`
+	m, _ := newTestManager(t, testPoolConfig, node)
+
+	eventRecorder := record.NewFakeRecorder(10)
+	m.eventRecorder = eventRecorder
+
+	// previous pools are read from the managed keys annotation
+	m.nodeQueue.Add("node-1")
+	processNextNodeWithTimeout(t, m)
+
+	events := []string{}
+	for len(eventRecorder.Events) > 0 {
+		events = append(events, <-eventRecorder.Events)
+	}
+
+	expectedEvent := "Normal PoolNotMatching node is no longer matching pool removed"
+	if len(events) != 2 || events[1] != expectedEvent {
+		t.Errorf("Expected event \"%s\", got %v", expectedEvent, events)
+	}
+}
+
+type (
+	// blockingClientset blocks node patches until released, the fake clientset holds its lock during reactors
+	blockingClientset struct {
+		*fake.Clientset
+		patch *blockingPatch
+	}
+
+	blockingCoreV1 struct {
+		typedcorev1.CoreV1Interface
+		patch *blockingPatch
+	}
+
+	blockingNodes struct {
+		typedcorev1.NodeInterface
+		patch *blockingPatch
+	}
+
+	blockingPatch struct {
+		startedOnce sync.Once
+		started     chan struct{}
+		release     chan struct{}
+	}
+)
+
+func (c *blockingClientset) CoreV1() typedcorev1.CoreV1Interface {
+	return &blockingCoreV1{CoreV1Interface: c.Clientset.CoreV1(), patch: c.patch}
+}
+
+func (c *blockingCoreV1) Nodes() typedcorev1.NodeInterface {
+	return &blockingNodes{NodeInterface: c.CoreV1Interface.Nodes(), patch: c.patch}
+}
+
+func (c *blockingNodes) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*corev1.Node, error) {
+	c.patch.startedOnce.Do(func() { close(c.patch.started) })
+	select {
+	case <-c.patch.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return c.NodeInterface.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+// startWithBlockedPatch starts the manager as leader, returns when the node patch is in-flight
+func startWithBlockedPatch(t *testing.T) (*KubePoolManager, *fake.Clientset, context.CancelFunc, chan struct{}) {
+	t.Helper()
+
+	m, client := newTestManager(t, testPoolConfig, buildNode("node-1"))
+	enableTestLease(m)
+	m.Opts.K8s.WatchTimeout = time.Hour
+
+	patch := &blockingPatch{started: make(chan struct{}), release: make(chan struct{})}
+	m.k8sClient = &blockingClientset{Clientset: client, patch: patch}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m.ctx = ctx
+
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case <-patch.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected node patch to be started")
+	}
+
+	return m, client, cancel, patch.release
+}
+
+func Test_ShutdownWaitsForWorkers(t *testing.T) {
+	m, client, cancel, releasePatch := startWithBlockedPatch(t)
+	cancel()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		m.Shutdown(context.Background())
+		close(shutdownDone)
+	}()
+
+	// lease is held until the in-flight node patch is finished
+	select {
+	case <-shutdownDone:
+		t.Fatal("Expected shutdown to wait for in-flight node patch")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if holder := leaseHolder(t, client, m); holder != testLeaseIdentity {
+		t.Errorf("Expected lease to be held during node patch, got holder %v", holder)
+	}
+
+	close(releasePatch)
+	select {
+	case <-shutdownDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected shutdown to finish after node patch")
+	}
+
+	node, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if node.Labels["webdevops.io/pool"] != "worker" {
+		t.Errorf("Expected in-flight node patch to be finished, got labels %v", node.Labels)
+	}
+	if holder := leaseHolder(t, client, m); holder != "" {
+		t.Errorf("Expected lease to be released, got holder %v", holder)
+	}
+}
+
+func Test_ShutdownGracePeriodExpired(t *testing.T) {
+	m, client, cancel, _ := startWithBlockedPatch(t)
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shutdownCancel()
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		m.Shutdown(shutdownCtx)
+		close(shutdownDone)
+	}()
+
+	// in-flight node patch is abandoned, lease is released anyway
+	select {
+	case <-shutdownDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected shutdown to finish after grace period")
+	}
+	if m.workCtx.Err() == nil {
+		t.Error("Expected in-flight node patches to be cancelled")
+	}
+	if holder := leaseHolder(t, client, m); holder != "" {
+		t.Errorf("Expected lease to be released, got holder %v", holder)
+	}
+}
+
+func Test_SetConfigStrict(t *testing.T) {
+	m, _ := newTestManager(t, testPoolConfig)
+
+	conf, err := config.Parse([]byte(`
+pools:
+  - pool: worker
+    node:
+      labels:
+        webdevops.io/pool: "invalid value"
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// strict errors are only rejected with --config.strict
+	m.Opts.ConfigStrict = true
+	if err := m.SetConfig(conf); err == nil {
+		t.Error("Expected strict configuration error")
+	}
+	if m.GetConfig().Hash() == conf.Hash() {
+		t.Error("Expected previous configuration to be kept")
+	}
+
+	m.Opts.ConfigStrict = false
+	if err := m.SetConfig(conf); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if m.GetConfig().Hash() != conf.Hash() {
+		t.Error("Expected configuration to be activated")
+	}
+}
@@ -0,0 +1,310 @@
+package manager
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+func (r *KubePoolManager) initPrometheus() {
+	registry := r.metricsRegistry
+	if registry == nil {
+		registry = prometheus.DefaultRegisterer
+	}
+
+	r.prometheus.nodePoolStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_node_pool_status",
+			Help: "kube-pool-manager node pool config status",
+		},
+		[]string{"nodeName", "pool"},
+	)
+	registry.MustRegister(r.prometheus.nodePoolStatus)
+
+	r.prometheus.nodeApplied = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_node_applied",
+			Help: "kube-pool-manager node applied time",
+		},
+		[]string{"nodeName"},
+	)
+	registry.MustRegister(r.prometheus.nodeApplied)
+
+	r.prometheus.nodePatched = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "poolmanager_node_patched_total",
+			Help: "kube-pool-manager number of node patches sent to the API server",
+		},
+	)
+	registry.MustRegister(r.prometheus.nodePatched)
+
+	r.prometheus.nodePatchSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "poolmanager_node_patch_skipped_total",
+			Help: "kube-pool-manager number of skipped node patches (node already up to date)",
+		},
+	)
+	registry.MustRegister(r.prometheus.nodePatchSkipped)
+
+	r.prometheus.configReload = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "poolmanager_config_reload_total",
+			Help: "kube-pool-manager number of configuration reloads",
+		},
+		[]string{"result"},
+	)
+	registry.MustRegister(r.prometheus.configReload)
+
+	r.prometheus.configReloadStatus = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_config_last_reload_successful",
+			Help: "kube-pool-manager status of last configuration reload",
+		},
+	)
+	registry.MustRegister(r.prometheus.configReloadStatus)
+	r.prometheus.configReloadStatus.Set(1)
+
+	r.prometheus.configReloadTime = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_config_last_reload_success_timestamp_seconds",
+			Help: "kube-pool-manager timestamp of last successful configuration reload",
+		},
+	)
+	registry.MustRegister(r.prometheus.configReloadTime)
+	r.prometheus.configReloadTime.SetToCurrentTime()
+
+	r.prometheus.nodePatchAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "poolmanager_pool_patch_attempts_total",
+			Help: "kube-pool-manager number of node patch attempts by pool",
+		},
+		[]string{"pool"},
+	)
+	registry.MustRegister(r.prometheus.nodePatchAttempts)
+
+	r.prometheus.nodePatchSuccess = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "poolmanager_pool_patch_success_total",
+			Help: "kube-pool-manager number of successful node patches by pool",
+		},
+		[]string{"pool"},
+	)
+	registry.MustRegister(r.prometheus.nodePatchSuccess)
+
+	r.prometheus.nodePatchFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "poolmanager_pool_patch_failures_total",
+			Help: "kube-pool-manager number of failed node patches by pool and error reason",
+		},
+		[]string{"pool", "reason"},
+	)
+	registry.MustRegister(r.prometheus.nodePatchFailures)
+
+	r.prometheus.nodePatchDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "poolmanager_node_patch_duration_seconds",
+			Help:    "kube-pool-manager latency of node patch requests to the API server",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+	registry.MustRegister(r.prometheus.nodePatchDuration)
+
+	r.prometheus.nodeWatchRestarts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "poolmanager_node_watch_restarts_total",
+			Help: "kube-pool-manager number of node watch restarts",
+		},
+	)
+	registry.MustRegister(r.prometheus.nodeWatchRestarts)
+
+	r.prometheus.nodeWatchErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "poolmanager_node_watch_errors_total",
+			Help: "kube-pool-manager number of node watch errors",
+		},
+	)
+	registry.MustRegister(r.prometheus.nodeWatchErrors)
+
+	r.prometheus.poolNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_pool_nodes",
+			Help: "kube-pool-manager number of nodes matching the pool",
+		},
+		[]string{"pool"},
+	)
+	registry.MustRegister(r.prometheus.poolNodes)
+
+	r.prometheus.poolFailedNodes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_pool_failed_nodes",
+			Help: "kube-pool-manager number of nodes where the pool failed (broken pool or failed patch)",
+		},
+		[]string{"pool"},
+	)
+	registry.MustRegister(r.prometheus.poolFailedNodes)
+
+	r.prometheus.fullReconcileAge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_full_reconcile_age_seconds",
+			Help: "kube-pool-manager seconds since the last full reconcile of all nodes (NaN if no full reconcile was run yet)",
+		},
+		func() float64 {
+			lastReconcile := r.lastFullReconcile.Load()
+			if lastReconcile == 0 {
+				return math.NaN()
+			}
+			return time.Since(time.Unix(0, lastReconcile)).Seconds()
+		},
+	)
+	registry.MustRegister(r.prometheus.fullReconcileAge)
+
+	r.prometheus.leader = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_leader",
+			Help: "kube-pool-manager leader status (1 if this instance is the leader or leader election is disabled)",
+		},
+	)
+	registry.MustRegister(r.prometheus.leader)
+	if !r.Opts.Lease.Enabled {
+		r.prometheus.leader.Set(1)
+	}
+
+	r.prometheus.configInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "poolmanager_config_info",
+			Help: "kube-pool-manager information about the active configuration",
+		},
+		[]string{"hash"},
+	)
+	registry.MustRegister(r.prometheus.configInfo)
+	r.updateConfigMetrics()
+}
+
+// updateConfigMetrics sets the info metric of the active configuration
+func (m *KubePoolManager) updateConfigMetrics() {
+	if m.prometheus.configInfo == nil {
+		return
+	}
+
+	hash := ""
+	if conf := m.fileConfig.Load(); conf != nil {
+		hash = conf.Hash()
+	}
+
+	m.prometheus.configInfo.Reset()
+	m.prometheus.configInfo.WithLabelValues(hash).Set(1)
+}
+
+// updatePoolMetrics sets the number of matching and failed nodes of all configured pools
+func (m *KubePoolManager) updatePoolMetrics() {
+	poolNodes := map[string]int{}
+	poolFailedNodes := map[string]int{}
+	if conf := m.GetConfig(); conf != nil {
+		for _, pool := range conf.Pools {
+			poolNodes[pool.Name] = 0
+			poolFailedNodes[pool.Name] = 0
+		}
+	}
+
+	// pools which are not configured anymore are not reported (nodes are still members until they are applied again)
+	m.nodePatchStatusLock.RLock()
+	for _, poolNameList := range m.nodePoolMembership {
+		for _, poolName := range poolNameList {
+			if _, exists := poolNodes[poolName]; exists {
+				poolNodes[poolName]++
+			}
+		}
+	}
+	m.nodePatchStatusLock.RUnlock()
+
+	m.poolStatusLock.RLock()
+	for poolName, applyErrors := range m.poolApplyErrors {
+		if _, exists := poolFailedNodes[poolName]; exists {
+			poolFailedNodes[poolName] = len(applyErrors)
+		}
+	}
+	m.poolStatusLock.RUnlock()
+
+	m.prometheus.poolNodes.Reset()
+	for poolName, count := range poolNodes {
+		m.prometheus.poolNodes.WithLabelValues(poolName).Set(float64(count))
+	}
+
+	m.prometheus.poolFailedNodes.Reset()
+	for poolName, count := range poolFailedNodes {
+		m.prometheus.poolFailedNodes.WithLabelValues(poolName).Set(float64(count))
+	}
+}
+
+// deleteRemovedPoolMetrics deletes the series and the apply status of pools which were removed from the configuration
+// (config reload or NodePool deletion)
+func (m *KubePoolManager) deleteRemovedPoolMetrics(previousConf, conf *config.Config) {
+	if previousConf == nil || m.prometheus.poolNodes == nil {
+		return
+	}
+
+	poolNames := map[string]bool{}
+	for _, pool := range conf.Pools {
+		poolNames[pool.Name] = true
+	}
+
+	for _, pool := range previousConf.Pools {
+		if poolNames[pool.Name] {
+			continue
+		}
+
+		m.prometheus.nodePoolStatus.DeletePartialMatch(prometheus.Labels{"pool": pool.Name})
+		m.prometheus.nodePatchAttempts.DeleteLabelValues(pool.Name)
+		m.prometheus.nodePatchSuccess.DeleteLabelValues(pool.Name)
+		m.prometheus.nodePatchFailures.DeletePartialMatch(prometheus.Labels{"pool": pool.Name})
+
+		m.poolStatusLock.Lock()
+		delete(m.poolLastApplied, pool.Name)
+		delete(m.poolApplyErrors, pool.Name)
+		m.poolStatusLock.Unlock()
+	}
+
+	m.updatePoolMetrics()
+}
+
+// recordPatchMetrics counts a node patch for all applied pools, patches of nodes without matching pools
+// (eg. removal of managed keys) are counted with an empty pool label
+func (m *KubePoolManager) recordPatchMetrics(poolNameList []string, patchErr error) {
+	if len(poolNameList) == 0 {
+		poolNameList = []string{""}
+	}
+
+	for _, poolName := range poolNameList {
+		m.prometheus.nodePatchAttempts.WithLabelValues(poolName).Inc()
+		if patchErr != nil {
+			m.prometheus.nodePatchFailures.WithLabelValues(poolName, patchErrorReason(patchErr)).Inc()
+		} else {
+			m.prometheus.nodePatchSuccess.WithLabelValues(poolName).Inc()
+		}
+	}
+}
+
+// deleteNodeMetrics removes all metric series of a deleted node
+func (m *KubePoolManager) deleteNodeMetrics(nodeName string) {
+	m.prometheus.nodePoolStatus.DeletePartialMatch(prometheus.Labels{"nodeName": nodeName})
+	m.prometheus.nodeApplied.DeleteLabelValues(nodeName)
+}
+
+// patchErrorReason returns the reason of the API server response (eg. Conflict, Forbidden, Invalid) or
+// "Internal" if the patch was not sent
+func patchErrorReason(err error) string {
+	var apiStatus k8serrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		if reason := k8serrors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+			return string(reason)
+		}
+		return "Unknown"
+	}
+	return "Internal"
+}
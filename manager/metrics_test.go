@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/webdevops/kube-pool-manager/config"
+)
+
+func Test_RecordPatchMetrics(t *testing.T) {
+	m, _ := newTestManager(t, testPoolConfig)
+
+	m.recordPatchMetrics([]string{"worker", "gpu"}, nil)
+	m.recordPatchMetrics([]string{"worker"}, k8serrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node-1", errors.New("conflict")))
+	m.recordPatchMetrics([]string{}, errors.New("failed to create json patch"))
+
+	expected := []struct {
+		name     string
+		value    float64
+		observed float64
+	}{
+		{"attempts worker", 2, testutil.ToFloat64(m.prometheus.nodePatchAttempts.WithLabelValues("worker"))},
+		{"attempts gpu", 1, testutil.ToFloat64(m.prometheus.nodePatchAttempts.WithLabelValues("gpu"))},
+		{"attempts without pool", 1, testutil.ToFloat64(m.prometheus.nodePatchAttempts.WithLabelValues(""))},
+		{"success worker", 1, testutil.ToFloat64(m.prometheus.nodePatchSuccess.WithLabelValues("worker"))},
+		{"success gpu", 1, testutil.ToFloat64(m.prometheus.nodePatchSuccess.WithLabelValues("gpu"))},
+		{"failures worker", 1, testutil.ToFloat64(m.prometheus.nodePatchFailures.WithLabelValues("worker", "Conflict"))},
+		{"failures without pool", 1, testutil.ToFloat64(m.prometheus.nodePatchFailures.WithLabelValues("", "Internal"))},
+	}
+	for _, metric := range expected {
+		if metric.observed != metric.value {
+			t.Errorf("Expected %v to be %v, got %v", metric.name, metric.value, metric.observed)
+		}
+	}
+}
+
+func Test_DeleteNodeMetrics(t *testing.T) {
+	m, _ := newTestManager(t, testPoolConfig)
+
+	m.prometheus.nodePoolStatus.WithLabelValues("node-1", "worker").Set(1)
+	m.prometheus.nodePoolStatus.WithLabelValues("node-1", "gpu").Set(0)
+	m.prometheus.nodePoolStatus.WithLabelValues("node-2", "worker").Set(1)
+	m.prometheus.nodeApplied.WithLabelValues("node-1").SetToCurrentTime()
+	m.prometheus.nodeApplied.WithLabelValues("node-2").SetToCurrentTime()
+
+	m.deleteNodeMetrics("node-1")
+
+	if count := testutil.CollectAndCount(m.prometheus.nodePoolStatus); count != 1 {
+		t.Errorf("Expected only pool status of node-2, got %v series", count)
+	}
+	if count := testutil.CollectAndCount(m.prometheus.nodeApplied); count != 1 {
+		t.Errorf("Expected only applied time of node-2, got %v series", count)
+	}
+	if value := testutil.ToFloat64(m.prometheus.nodePoolStatus.WithLabelValues("node-2", "worker")); value != 1 {
+		t.Errorf("Expected pool status of node-2 to be kept, got %v", value)
+	}
+}
+
+func Test_PatchErrorReason(t *testing.T) {
+	for _, testCase := range []struct {
+		err    error
+		reason string
+	}{
+		{k8serrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node-1", errors.New("conflict")), "Conflict"},
+		{k8serrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "node-1", errors.New("forbidden")), "Forbidden"},
+		{errors.New("failed to create json patch"), "Internal"},
+	} {
+		if reason := patchErrorReason(testCase.err); reason != testCase.reason {
+			t.Errorf("Expected reason %v for %v, got %v", testCase.reason, testCase.err, reason)
+		}
+	}
+}
+
+func Test_DeleteRemovedPoolMetrics(t *testing.T) {
+	m, _ := newTestManager(t, `
+pools:
+  - pool: worker
+  - pool: removed
+`)
+
+	m.recordPoolApply("node-1", []string{"worker", "removed"}, nil, nil)
+	m.recordPoolApply("node-2", []string{"removed"}, errors.New("patch failed"), nil)
+	m.prometheus.nodePoolStatus.WithLabelValues("node-1", "worker").Set(1)
+	m.prometheus.nodePoolStatus.WithLabelValues("node-1", "removed").Set(1)
+	m.recordPatchMetrics([]string{"worker", "removed"}, nil)
+	m.recordPatchMetrics([]string{"removed"}, errors.New("patch failed"))
+
+	if value := testutil.ToFloat64(m.prometheus.poolNodes.WithLabelValues("removed")); value != 1 {
+		t.Errorf("Expected one node in pool removed, got %v", value)
+	}
+
+	// pool is removed by a config reload
+	conf, err := config.Parse([]byte("pools:\n  - pool: worker"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := m.SetConfig(conf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedCounts := map[string]int{
+		"poolmanager_pool_nodes":                1,
+		"poolmanager_pool_failed_nodes":         1,
+		"poolmanager_node_pool_status":          1,
+		"poolmanager_pool_patch_attempts_total": 1,
+		"poolmanager_pool_patch_success_total":  1,
+		"poolmanager_pool_patch_failures_total": 0,
+	}
+	for metricName, collector := range map[string]prometheus.Collector{
+		"poolmanager_pool_nodes":                m.prometheus.poolNodes,
+		"poolmanager_pool_failed_nodes":         m.prometheus.poolFailedNodes,
+		"poolmanager_node_pool_status":          m.prometheus.nodePoolStatus,
+		"poolmanager_pool_patch_attempts_total": m.prometheus.nodePatchAttempts,
+		"poolmanager_pool_patch_success_total":  m.prometheus.nodePatchSuccess,
+		"poolmanager_pool_patch_failures_total": m.prometheus.nodePatchFailures,
+	} {
+		if count := testutil.CollectAndCount(collector); count != expectedCounts[metricName] {
+			t.Errorf("Expected %v series of %v, got %v", expectedCounts[metricName], metricName, count)
+		}
+	}
+
+	if value := testutil.ToFloat64(m.prometheus.poolNodes.WithLabelValues("worker")); value != 1 {
+		t.Errorf("Expected one node in pool worker, got %v", value)
+	}
+	if _, exists := m.poolApplyErrors["removed"]; exists {
+		t.Error("Expected apply errors of removed pool to be deleted")
+	}
+}
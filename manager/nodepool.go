@@ -0,0 +1,306 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/webdevops/kube-pool-manager/config"
+	"github.com/webdevops/kube-pool-manager/k8s"
+)
+
+const (
+	// limits of the errors in the NodePool status (size of the object is limited by etcd)
+	nodePoolStatusMaxErrors = 10
+	nodePoolStatusMaxNodes  = 5
+)
+
+// startNodePoolWatch watches NodePool objects and merges them into the active configuration
+func (m *KubePoolManager) startNodePoolWatch(ctx context.Context) error {
+	if !m.Opts.NodePool.Enabled {
+		return nil
+	}
+
+	informerFactory := dynamicinformer.NewDynamicSharedInformerFactory(m.dynamicClient, 0)
+	nodePoolInformer := informerFactory.ForResource(k8s.NodePoolGroupVersionResource)
+	m.nodePoolLister = nodePoolInformer.Lister()
+
+	_, err := nodePoolInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			m.updateNodePools()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNodePool, oldOk := oldObj.(*unstructured.Unstructured)
+			newNodePool, newOk := newObj.(*unstructured.Unstructured)
+			// status updates don't change the generation
+			if oldOk && newOk && oldNodePool.GetGeneration() == newNodePool.GetGeneration() {
+				return
+			}
+			m.updateNodePools()
+		},
+		DeleteFunc: func(obj interface{}) {
+			m.updateNodePools()
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	m.Logger.Info("starting NodePool informer")
+	informerFactory.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), nodePoolInformer.Informer().HasSynced) {
+		return fmt.Errorf("failed to sync NodePool informer cache")
+	}
+	m.updateNodePools()
+
+	go func() {
+		ticker := time.NewTicker(m.Opts.NodePool.StatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.updateNodePoolStatus()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// updateNodePools parses all NodePool objects and activates them as configuration,
+// broken NodePools are skipped and reported in their status
+func (m *KubePoolManager) updateNodePools() {
+	if m.nodePoolLister == nil {
+		return
+	}
+
+	objList, err := m.nodePoolLister.List(labels.Everything())
+	if err != nil {
+		m.Logger.Errorf("failed to list NodePools: %v", err)
+		return
+	}
+
+	// pool names have to be unique, pools of the configuration file take precedence
+	filePoolNames := map[string]bool{}
+	if fileConfig := m.fileConfig.Load(); fileConfig != nil {
+		for _, poolConfig := range fileConfig.Pools {
+			filePoolNames[poolConfig.Name] = true
+		}
+	}
+
+	nodePools := []*config.NodePoolSpec{}
+	nodePoolErrors := map[string]string{}
+	for _, obj := range objList {
+		nodePoolObj, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		spec, _, err := unstructured.NestedMap(nodePoolObj.Object, "spec")
+		if err == nil && filePoolNames[nodePoolObj.GetName()] {
+			err = fmt.Errorf(`pool name "%v" is already used by the configuration file`, nodePoolObj.GetName())
+		}
+		if err == nil {
+			var nodePool *config.NodePoolSpec
+			if nodePool, err = config.ParseNodePoolSpec(nodePoolObj.GetName(), spec); err == nil {
+				nodePools = append(nodePools, nodePool)
+				continue
+			}
+		}
+
+		m.Logger.Errorf(`failed to parse NodePool "%v", ignoring NodePool: %v`, nodePoolObj.GetName(), err)
+		nodePoolErrors[nodePoolObj.GetName()] = err.Error()
+	}
+
+	m.poolStatusLock.Lock()
+	m.nodePoolErrors = nodePoolErrors
+	m.poolStatusLock.Unlock()
+
+	m.nodePools.Store(&nodePools)
+	m.updateConfig()
+
+	// reconcile all nodes with the new configuration
+	if m.nodeWatchReady.Load() {
+		m.Logger.Info("NodePools changed, reapply node pool settings")
+		if err := m.startupApply(m.ctx); err != nil {
+			m.Logger.Errorf("failed to reapply node pool settings: %v", err)
+		}
+	}
+}
+
+// updateNodePoolStatus writes matched nodes, last apply time and errors into the status of all NodePools
+func (m *KubePoolManager) updateNodePoolStatus() {
+	objList, err := m.nodePoolLister.List(labels.Everything())
+	if err != nil {
+		m.Logger.Errorf("failed to list NodePools: %v", err)
+		return
+	}
+
+	matchedNodes := map[string]int{}
+	m.nodePatchStatusLock.RLock()
+	for _, poolNameList := range m.nodePoolMembership {
+		for _, poolName := range poolNameList {
+			matchedNodes[poolName]++
+		}
+	}
+	m.nodePatchStatusLock.RUnlock()
+
+	for _, obj := range objList {
+		nodePoolObj, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		poolName := nodePoolObj.GetName()
+
+		status := k8s.NodePoolStatus{
+			ObservedGeneration: nodePoolObj.GetGeneration(),
+			MatchedNodes:       matchedNodes[poolName],
+		}
+
+		m.poolStatusLock.RLock()
+		if lastApplied, exists := m.poolLastApplied[poolName]; exists {
+			status.LastAppliedTime = &metav1.Time{Time: lastApplied}
+		}
+		if parseError, exists := m.nodePoolErrors[poolName]; exists {
+			status.Errors = append(status.Errors, parseError)
+		}
+		status.Errors = append(status.Errors, nodePoolStatusErrors(m.poolApplyErrors[poolName])...)
+		m.poolStatusLock.RUnlock()
+
+		statusObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+		if err != nil {
+			m.Logger.Errorf(`failed to build status of NodePool "%v": %v`, poolName, err)
+			continue
+		}
+
+		if currentStatus, _, _ := unstructured.NestedMap(nodePoolObj.Object, "status"); reflect.DeepEqual(currentStatus, statusObj) {
+			continue
+		}
+
+		nodePoolObj = nodePoolObj.DeepCopy()
+		if err := unstructured.SetNestedMap(nodePoolObj.Object, statusObj, "status"); err != nil {
+			m.Logger.Errorf(`failed to set status of NodePool "%v": %v`, poolName, err)
+			continue
+		}
+
+		if m.Opts.DryRun {
+			continue
+		}
+
+		if _, err := m.dynamicClient.Resource(k8s.NodePoolGroupVersionResource).UpdateStatus(m.ctx, nodePoolObj, metav1.UpdateOptions{}); err != nil {
+			m.Logger.Errorf(`failed to update status of NodePool "%v": %v`, poolName, err)
+		}
+	}
+}
+
+// nodePoolStatusErrors groups the apply errors (node name => error) by error message, the number of errors and
+// node names per error are limited, so the NodePool status doesn't grow with the number of failing nodes
+func nodePoolStatusErrors(applyErrors map[string]string) []string {
+	nodesByError := map[string][]string{}
+	for nodeName, applyError := range applyErrors {
+		nodesByError[applyError] = append(nodesByError[applyError], nodeName)
+	}
+
+	errorList := make([]string, 0, len(nodesByError))
+	for applyError := range nodesByError {
+		errorList = append(errorList, applyError)
+	}
+	sort.Strings(errorList)
+
+	ret := []string{}
+	for num, applyError := range errorList {
+		if num >= nodePoolStatusMaxErrors {
+			ret = append(ret, fmt.Sprintf("and %v more errors", len(errorList)-num))
+			break
+		}
+
+		nodeNameList := nodesByError[applyError]
+		sort.Strings(nodeNameList)
+
+		switch {
+		case len(nodeNameList) == 1:
+			ret = append(ret, fmt.Sprintf(`node "%v": %v`, nodeNameList[0], applyError))
+		case len(nodeNameList) > nodePoolStatusMaxNodes:
+			ret = append(ret, fmt.Sprintf(`%v nodes ("%v" and %v more): %v`, len(nodeNameList), strings.Join(nodeNameList[:nodePoolStatusMaxNodes], `", "`), len(nodeNameList)-nodePoolStatusMaxNodes, applyError))
+		default:
+			ret = append(ret, fmt.Sprintf(`%v nodes ("%v"): %v`, len(nodeNameList), strings.Join(nodeNameList, `", "`), applyError))
+		}
+	}
+
+	return ret
+}
+
+// recordPoolApply tracks pool membership and apply status of a node (used for NodePool status, metrics and api),
+// broken pools are marked as failed
+func (m *KubePoolManager) recordPoolApply(nodeName string, poolNameList []string, applyErr error, poolErrors config.PoolErrors) {
+	defer m.updatePoolMetrics()
+
+	m.nodePatchStatusLock.Lock()
+	if applyErr == nil {
+		m.nodePoolMembership[nodeName] = poolNameList
+		m.nodeApplyStatus[nodeName] = &nodeApplyStatus{lastApplied: time.Now()}
+		if len(poolErrors) > 0 {
+			m.nodeApplyStatus[nodeName].lastError = poolErrors.Error()
+		}
+	} else {
+		applyStatus := &nodeApplyStatus{lastError: applyErr.Error()}
+		if previousStatus, exists := m.nodeApplyStatus[nodeName]; exists {
+			applyStatus.lastApplied = previousStatus.lastApplied
+		}
+		m.nodeApplyStatus[nodeName] = applyStatus
+	}
+	m.nodePatchStatusLock.Unlock()
+
+	m.poolStatusLock.Lock()
+	defer m.poolStatusLock.Unlock()
+
+	// remove errors of previous applies
+	for poolName, applyErrors := range m.poolApplyErrors {
+		delete(applyErrors, nodeName)
+		if len(applyErrors) == 0 {
+			delete(m.poolApplyErrors, poolName)
+		}
+	}
+
+	for _, poolName := range poolNameList {
+		if applyErr != nil {
+			if _, exists := m.poolApplyErrors[poolName]; !exists {
+				m.poolApplyErrors[poolName] = map[string]string{}
+			}
+			m.poolApplyErrors[poolName][nodeName] = applyErr.Error()
+		} else {
+			m.poolLastApplied[poolName] = time.Now()
+		}
+	}
+
+	for _, poolError := range poolErrors {
+		if _, exists := m.poolApplyErrors[poolError.Pool]; !exists {
+			m.poolApplyErrors[poolError.Pool] = map[string]string{}
+		}
+		m.poolApplyErrors[poolError.Pool][nodeName] = poolError.Err.Error()
+	}
+}
+
+// removeNodePoolMembership removes the pool membership of a deleted node
+func (m *KubePoolManager) removeNodePoolMembership(nodeName string) {
+	m.recordPoolApply(nodeName, nil, nil, nil)
+
+	m.nodePatchStatusLock.Lock()
+	delete(m.nodePoolMembership, nodeName)
+	delete(m.nodeApplyStatus, nodeName)
+	m.nodePatchStatusLock.Unlock()
+	m.updatePoolMetrics()
+}
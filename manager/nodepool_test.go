@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_NodePoolStatusErrors(t *testing.T) {
+	applyErrors := map[string]string{
+		"node-1": "template failed",
+		"node-2": "template failed",
+		"node-3": "patch failed",
+	}
+
+	expected := []string{
+		`node "node-3": patch failed`,
+		`2 nodes ("node-1", "node-2"): template failed`,
+	}
+	if errors := nodePoolStatusErrors(applyErrors); !reflect.DeepEqual(errors, expected) {
+		t.Errorf("Expected errors %v, got %v", expected, errors)
+	}
+
+	// nodes with the same error are limited
+	applyErrors = map[string]string{}
+	for num := 0; num < 100; num++ {
+		applyErrors[fmt.Sprintf("node-%02d", num)] = "template failed"
+	}
+	expected = []string{
+		`100 nodes ("node-00", "node-01", "node-02", "node-03", "node-04" and 95 more): template failed`,
+	}
+	if errors := nodePoolStatusErrors(applyErrors); !reflect.DeepEqual(errors, expected) {
+		t.Errorf("Expected errors %v, got %v", expected, errors)
+	}
+
+	// number of different errors is limited
+	applyErrors = map[string]string{}
+	for num := 0; num < 100; num++ {
+		applyErrors[fmt.Sprintf("node-%02d", num)] = fmt.Sprintf("error %02d", num)
+	}
+	errors := nodePoolStatusErrors(applyErrors)
+	if len(errors) != nodePoolStatusMaxErrors+1 || errors[nodePoolStatusMaxErrors] != "and 90 more errors" {
+		t.Errorf("Expected %v errors and summary, got %v", nodePoolStatusMaxErrors, errors)
+	}
+
+	if errors := nodePoolStatusErrors(nil); len(errors) != 0 {
+		t.Errorf("Expected no errors, got %v", errors)
+	}
+}